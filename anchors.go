@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+
+	"github.com/knakk/kbp/rdf"
+)
+
+var rgxpAnchorUnsafe = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// predicateAnchor is the anchor of a predicate of the described resource,
+// e.g. #deich-hasItem, with the number of its values.
+type predicateAnchor struct {
+	id    string
+	pred  rdf.NamedNode
+	count int
+}
+
+// predicateAnchors returns the anchors of the predicates of node, in the
+// order of the description. The ids are the prefixed names of the
+// predicates, with the colon and other characters not safe in fragments
+// replaced by hyphens.
+func (srv server) predicateAnchors(node rdf.NamedNode, trs []rdf.Triple) []*predicateAnchor {
+	var anchors []*predicateAnchor
+	found := make(map[string]*predicateAnchor)
+	ids := make(map[string]bool)
+	for _, tr := range trs {
+		if tr.Subject != node {
+			continue
+		}
+		if a, ok := found[tr.Predicate.Name()]; ok {
+			a.count++
+			continue
+		}
+		base := rgxpAnchorUnsafe.ReplaceAllString(srv.compactIRI(tr.Predicate.Name()), "-")
+		id := base
+		for i := 2; ids[id]; i++ {
+			id = base + "-" + strconv.Itoa(i)
+		}
+		ids[id] = true
+		a := &predicateAnchor{id: id, pred: tr.Predicate, count: 1}
+		found[tr.Predicate.Name()] = a
+		anchors = append(anchors, a)
+	}
+	return anchors
+}
+
+// anchorStyle is implemented by term styles giving the predicates of the
+// described resource anchors.
+type anchorStyle interface {
+	// anchor returns the predicate p of the described resource, rendered
+	// as name, with its anchor.
+	anchor(p rdf.NamedNode, name string) string
+}
+
+func (s htmlStyle) anchor(p rdf.NamedNode, name string) string {
+	id, ok := s.anchors[p.Name()]
+	if !ok {
+		return name
+	}
+	return fmt.Sprintf(`<a id="%s" class="anchor" href="#%[1]s">%s</a>`, id, name)
+}
+
+// writeContents writes the table of contents of the description, linking
+// to the anchors of the predicates, if the resource has at least the
+// configured number of values.
+func (srv server) writeContents(w io.Writer, s htmlStyle, anchors []*predicateAnchor) {
+	n := 0
+	for _, a := range anchors {
+		n += a.count
+	}
+	if srv.contents == 0 || n < srv.contents {
+		return
+	}
+	io.WriteString(w, "<nav class=\"contents\"><details><summary>Contents</summary>\n<ul>\n")
+	for _, a := range anchors {
+		fmt.Fprintf(w, "<li><a href=\"#%s\">%s</a> (%d)</li>\n", a.id, s.predicate(a.pred), a.count)
+	}
+	io.WriteString(w, "</ul>\n</details></nav>\n")
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/knakk/kbp/rdf"
+)
+
+// The backends describing resources.
+const (
+	// backendVirtuoso queries Virtuoso, using its describe modes, query
+	// timeouts and scrolling of large results.
+	backendVirtuoso = "virtuoso"
+	// backendSPARQL queries any SPARQL 1.1 endpoint, e.g. Fuseki or
+	// Blazegraph, with standard queries only.
+	backendSPARQL = "sparql"
+	// backendMemory describes resources from N-Triples files loaded into
+	// memory.
+	backendMemory = "memory"
+)
+
+// backend fetches the descriptions of resources, reading no more than
+// limit triples if limit is not 0.
+type backend interface {
+	describe(ctx context.Context, res resolution, limit int) ([]rdf.Triple, error)
+}
+
+// sparqlBackend describes resources by running the queries of their
+// resolutions against the endpoints, merging the results.
+type sparqlBackend struct {
+	endpoints []string
+}
+
+func (b sparqlBackend) describe(ctx context.Context, res resolution, limit int) ([]rdf.Triple, error) {
+	return fetchTriples(ctx, b.endpoints, res.graph, res.query, limit)
+}
+
+// memoryBackend describes resources from triples held in memory, without
+// a SPARQL endpoint. The description of a resource is its triples and
+// those of the blank nodes they lead to; graphs, describe modes and
+// custom queries don't apply.
+type memoryBackend struct {
+	bySubject map[rdf.Node][]rdf.Triple
+}
+
+// newMemoryBackend loads the N-Triples files into a memory backend. Blank
+// nodes are relabeled per file, so that they are not confused with each
+// other.
+func newMemoryBackend(files []string) (memoryBackend, error) {
+	b := memoryBackend{bySubject: make(map[rdf.Node][]rdf.Triple)}
+	for i, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			return b, err
+		}
+		trs, err := decodeTriples(f, 0)
+		f.Close()
+		if err != nil {
+			return b, fmt.Errorf("%s: %v", name, err)
+		}
+		for _, tr := range trs {
+			if bn, ok := tr.Subject.(rdf.BlankNode); ok {
+				tr.Subject = relabel(bn, i)
+			}
+			if bn, ok := tr.Object.(rdf.BlankNode); ok {
+				tr.Object = relabel(bn, i)
+			}
+			b.bySubject[tr.Subject] = append(b.bySubject[tr.Subject], tr)
+		}
+	}
+	return b, nil
+}
+
+func (b memoryBackend) describe(ctx context.Context, res resolution, limit int) ([]rdf.Triple, error) {
+	var trs []rdf.Triple
+	subjects := []rdf.Node{rdf.NewNamedNode(res.uri)}
+	seen := make(map[rdf.Node]bool)
+	for len(subjects) > 0 {
+		s := subjects[0]
+		subjects = subjects[1:]
+		for _, tr := range b.bySubject[s] {
+			if limit > 0 && len(trs) >= limit {
+				return trs, nil
+			}
+			trs = append(trs, tr)
+			if bn, ok := tr.Object.(rdf.BlankNode); ok && !seen[bn] {
+				seen[bn] = true
+				subjects = append(subjects, bn)
+			}
+		}
+	}
+	return trs, nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/knakk/kbp/rdf"
+)
+
+const (
+	testWork   = "http://data.deichman.no/work/w1"
+	testPerson = "http://data.deichman.no/person/p1"
+)
+
+var testNTriples = []string{`<http://data.deichman.no/work/w1> <http://purl.org/dc/terms/title> "Sult" .
+<http://data.deichman.no/work/w1> <http://data.deichman.no/ontology#contributor> _:c1 .
+_:c1 <http://data.deichman.no/ontology#agent> <http://data.deichman.no/person/p1> .
+_:c1 <http://data.deichman.no/ontology#role> _:r1 .
+_:r1 <http://www.w3.org/2000/01/rdf-schema#label> "Author" .
+<http://data.deichman.no/person/p1> <http://schema.org/name> "Knut Hamsun" .
+`, `<http://data.deichman.no/person/p1> <http://data.deichman.no/ontology#birthYear> "1859" .
+_:c1 <http://data.deichman.no/ontology#note> "Not about the work" .
+`}
+
+// testMemoryBackend returns a memory backend loaded from the test data.
+func testMemoryBackend(t *testing.T) memoryBackend {
+	dir, err := ioutil.TempDir("", "vindu-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var files []string
+	for i, nt := range testNTriples {
+		name := filepath.Join(dir, string(rune('a'+i))+".nt")
+		if err := ioutil.WriteFile(name, []byte(nt), 0644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, name)
+	}
+	b, err := newMemoryBackend(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestMemoryBackendDescribe(t *testing.T) {
+	b := testMemoryBackend(t)
+	tests := []struct {
+		uri   string
+		limit int
+		want  int
+	}{
+		// The work, its contribution and the role of the contribution,
+		// but not the agent, which is not a blank node, nor the blank
+		// node of the same label in the other file.
+		{testWork, 0, 5},
+		{testWork, 2, 2},
+		{testWork, 5, 5},
+		{testWork, 100, 5},
+		// The person is described from both files.
+		{testPerson, 0, 2},
+		{"http://data.deichman.no/work/missing", 0, 0},
+	}
+	for _, test := range tests {
+		trs, err := b.describe(context.Background(), resolution{uri: test.uri}, test.limit)
+		if err != nil {
+			t.Fatalf("describe(%s, %d): %v", test.uri, test.limit, err)
+		}
+		if len(trs) != test.want {
+			t.Errorf("describe(%s, %d) = %d triples, want %d", test.uri, test.limit, len(trs), test.want)
+		}
+	}
+}
+
+func TestMemoryBackendBlankNodes(t *testing.T) {
+	b := testMemoryBackend(t)
+	trs, err := b.describe(context.Background(), resolution{uri: testWork}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every blank node used as an object is described, and every blank
+	// node described is reached from the work.
+	objects, subjects := make(map[rdf.Node]bool), make(map[rdf.Node]bool)
+	for _, tr := range trs {
+		if _, ok := tr.Object.(rdf.BlankNode); ok {
+			objects[tr.Object] = true
+		}
+		if _, ok := tr.Subject.(rdf.BlankNode); ok {
+			subjects[tr.Subject] = true
+		}
+		if tr.Predicate == rdf.NewNamedNode("http://data.deichman.no/ontology#note") {
+			t.Errorf("blank node of another file described: %v", tr)
+		}
+	}
+	if len(objects) != 2 {
+		t.Errorf("got %d blank nodes, want 2", len(objects))
+	}
+	for n := range objects {
+		if !subjects[n] {
+			t.Errorf("blank node %v not described", n)
+		}
+	}
+	for n := range subjects {
+		if !objects[n] {
+			t.Errorf("blank node %v described, but not reached", n)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/knakk/kbp/rdf"
+)
+
+// batchPath is where several resources are described at once, given by
+// their URIs in uri parameters, or as a JSON list in the body of a POST.
+const batchPath = "/batch"
+
+// truncatedURIsHeader is the response header listing the resources of a
+// batch whose descriptions are truncated, separated by spaces.
+const truncatedURIsHeader = "Vindu-Truncated-URIs"
+
+// describePrefix returns the query describing the resource without the
+// IRI of the resource, if it is a plain DESCRIBE, so that the IRIs of
+// other resources can be added to it.
+func describePrefix(res resolution) (string, bool) {
+	prefix := strings.TrimSuffix(res.query, "<"+res.uri+">")
+	return prefix, prefix != res.query && strings.HasSuffix(prefix, "DESCRIBE ")
+}
+
+// describedBy returns the triples of trs describing uri: those with it as
+// subject, and those of the blank nodes they lead to, followed by those
+// with it as object if incoming is set, as in SCBD.
+func describedBy(uri string, trs []rdf.Triple, incoming bool) []rdf.Triple {
+	node := rdf.NewNamedNode(uri)
+	var desc []rdf.Triple
+	seen := map[rdf.Node]bool{node: true}
+	subjects := []rdf.Node{node}
+	for len(subjects) > 0 {
+		s := subjects[0]
+		subjects = subjects[1:]
+		for _, tr := range trs {
+			if tr.Subject != s {
+				continue
+			}
+			desc = append(desc, tr)
+			if b, ok := tr.Object.(rdf.BlankNode); ok && !seen[b] {
+				seen[b] = true
+				subjects = append(subjects, b)
+			}
+		}
+	}
+	for _, tr := range trs {
+		if incoming && tr.Object == node && tr.Subject != node {
+			desc = append(desc, tr)
+		}
+	}
+	return desc
+}
+
+// serveBatch serves the descriptions of the resources given by URI, as a
+// JSON object with the description of each resource in the format
+// parameter, JSON-LD by default. Descriptions in JSON formats are
+// embedded as JSON, the others as strings. Resources without triples are
+// null, and descriptions are truncated like those of single resources:
+// the Vindu-Truncated header gives the triple limit, and
+// Vindu-Truncated-URIs the resources cut off at it.
+//
+// The plain DESCRIBE queries of the resources of a graph are sent as a
+// single query, and the triples split by resource. If the result may have
+// been cut off, by the triple limit or the maximum number of rows of the
+// endpoint, the resources are described on their own instead, like those
+// with custom queries and those of other backends.
+func (srv server) serveBatch(w http.ResponseWriter, r *http.Request) {
+	var uris []string
+	switch r.Method {
+	case "GET", "HEAD":
+		uris = r.URL.Query()["uri"]
+	case "POST":
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&uris); err != nil {
+			http.Error(w, fmt.Sprintf("invalid JSON list of URIs: %v", err), http.StatusBadRequest)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if len(uris) == 0 {
+		http.Error(w, "missing uri", http.StatusBadRequest)
+		return
+	}
+	if len(uris) > srv.batchSize {
+		http.Error(w, fmt.Sprintf("at most %d resources can be described at once", srv.batchSize), http.StatusBadRequest)
+		return
+	}
+	name := r.URL.Query().Get("format")
+	if name == "" {
+		name = "jsonld"
+	}
+	f, ok := formatByName(name)
+	if !ok || f.write == nil || f.mediaType == "text/html" {
+		http.Error(w, fmt.Sprintf("unsupported format: %q", name), http.StatusBadRequest)
+		return
+	}
+
+	// Resources are described once, in the order given.
+	resources := make(map[string]resolution)
+	var order []string
+	for _, uri := range uris {
+		if _, ok := resources[uri]; ok {
+			continue
+		}
+		res, err := srv.resolveURI(uri)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resources[uri] = res
+		order = append(order, uri)
+	}
+
+	descs := make(map[string][]rdf.Triple)
+	type batch struct {
+		graph, prefix string
+		uris          []string
+	}
+	var batches []*batch
+	byQuery := make(map[[2]string]*batch)
+	for _, uri := range order {
+		res := resources[uri]
+		prefix, ok := describePrefix(res)
+		if _, sparql := srv.backend.(sparqlBackend); !ok || !sparql {
+			trs, err := srv.fetchDescription(res)
+			if err != nil {
+				http.Error(w, err.Error(), upstreamStatus(w, err, http.StatusInternalServerError))
+				return
+			}
+			descs[uri] = trs
+			continue
+		}
+		key := [2]string{res.graph, prefix}
+		if byQuery[key] == nil {
+			byQuery[key] = &batch{graph: res.graph, prefix: prefix}
+			batches = append(batches, byQuery[key])
+		}
+		byQuery[key].uris = append(byQuery[key].uris, uri)
+	}
+	for _, b := range batches {
+		limit := srv.limit() * len(b.uris)
+		trs, err := srv.fetch(b.graph, b.prefix+"<"+strings.Join(b.uris, "> <")+">", limit)
+		if err != nil {
+			http.Error(w, err.Error(), upstreamStatus(w, err, http.StatusInternalServerError))
+			return
+		}
+		if limit > 0 && len(trs) >= limit || srv.maxRows > 0 && len(trs) >= srv.maxRows {
+			// One large description may have used up the rows of the
+			// others.
+			for _, uri := range b.uris {
+				if descs[uri], err = srv.fetchDescription(resources[uri]); err != nil {
+					http.Error(w, err.Error(), upstreamStatus(w, err, http.StatusInternalServerError))
+					return
+				}
+			}
+			continue
+		}
+		incoming := strings.Contains(strings.ToUpper(b.prefix), `"SCBD"`)
+		for _, uri := range b.uris {
+			descs[uri] = describedBy(uri, trs, incoming)
+		}
+	}
+
+	out := make(map[string]interface{}, len(order))
+	var truncated []string
+	for _, uri := range order {
+		trs, cut := srv.truncate(descs[uri])
+		if cut {
+			truncated = append(truncated, uri)
+		}
+		if len(trs) == 0 {
+			out[uri] = nil
+			continue
+		}
+		srv.sortTriples(trs)
+		var buf bytes.Buffer
+		if err := f.write(srv, &buf, resources[uri], trs); err != nil {
+			log.Println(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if strings.HasSuffix(f.mediaType, "json") {
+			out[uri] = json.RawMessage(buf.Bytes())
+		} else {
+			out[uri] = buf.String()
+		}
+	}
+	if len(truncated) > 0 {
+		w.Header().Set(truncatedHeader, strconv.Itoa(srv.tripleLimit))
+		w.Header().Set(truncatedURIsHeader, strings.Join(truncated, " "))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.Encode(out)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"strings"
+)
+
+const breadcrumbQuery = `SELECT * WHERE { <%s> <%s> ?parent FILTER isIRI(?parent) %s } LIMIT %d`
+
+// breadcrumbs are the resources above a resource, e.g. the work of a
+// publication, and the main agents of those, e.g. the contributors of
+// the work.
+type breadcrumbs struct {
+	parents []string
+	agents  []string
+}
+
+// iris returns the resources of the breadcrumbs.
+func (b breadcrumbs) iris() []string {
+	return append(append([]string(nil), b.parents...), b.agents...)
+}
+
+// breadcrumbs looks up the breadcrumbs of the resource, if configured.
+// A failing lookup is logged, and no breadcrumbs returned.
+func (srv server) breadcrumbs(res resolution) breadcrumbs {
+	var b breadcrumbs
+	if srv.crumbs.Parent == "" {
+		return b
+	}
+	var agents string
+	if len(srv.crumbs.Agents) > 0 {
+		path := "<" + strings.Join(srv.crumbs.Agents, ">/<") + ">"
+		agents = fmt.Sprintf("OPTIONAL { ?parent %s ?agent FILTER isIRI(?agent) }", path)
+	}
+	q := fmt.Sprintf(breadcrumbQuery, res.uri, srv.crumbs.Parent, agents, srv.crumbs.Limit)
+	rows, err := selectRows(srv.reqContext(), srv.endpoints[0], res.graph, q)
+	if err != nil {
+		log.Printf("looking up breadcrumbs: %v", err)
+		return b
+	}
+	seen := make(map[string]bool)
+	for _, row := range rows {
+		if p := row["parent"]; !seen[p] {
+			seen[p] = true
+			b.parents = append(b.parents, p)
+		}
+		if a := row["agent"]; a != "" && !seen[a] {
+			seen[a] = true
+			b.agents = append(b.agents, a)
+		}
+	}
+	return b
+}
+
+// writeBreadcrumbs writes the navigation from the agents and parents down
+// to the resource node. Nothing is written if there are no parents.
+func writeBreadcrumbs(w io.Writer, s htmlStyle, b breadcrumbs, node string) {
+	if len(b.parents) == 0 {
+		return
+	}
+	io.WriteString(w, "<nav class=\"breadcrumbs\">")
+	for _, level := range [][]string{b.agents, b.parents} {
+		if len(level) == 0 {
+			continue
+		}
+		for i, iri := range level {
+			if i > 0 {
+				io.WriteString(w, ", ")
+			}
+			io.WriteString(w, crumbLink(s, iri))
+		}
+		io.WriteString(w, " &rsaquo; ")
+	}
+	text := node
+	if rel, ok := s.link(node); ok {
+		text = rel
+	}
+	fmt.Fprintf(w, "<strong>%s</strong></nav>\n", html.EscapeString(text))
+}
+
+// crumbLink returns a link to the resource iri, with its label as text
+// if it has one.
+func crumbLink(s htmlStyle, iri string) string {
+	href, text := iri, iri
+	if rel, ok := s.link(iri); ok {
+		href, text = s.rt.prefix+"/"+rel, rel
+	}
+	if label, ok := s.labels[iri]; ok {
+		text = label
+	}
+	return fmt.Sprintf(`<a href="%s">%s</a>`, escapeHref(href), html.EscapeString(text))
+}
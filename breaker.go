@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// endpointDownError fails the requests to an endpoint which is down, as
+// told by the circuit breaker, without sending them.
+type endpointDownError struct {
+	host       string
+	retryAfter time.Duration
+}
+
+func (e endpointDownError) Error() string {
+	return fmt.Sprintf("%s is unavailable, retry in %v", e.host, e.retryAfter)
+}
+
+// breakerTransport is the circuit breaker of the SPARQL endpoints. After
+// threshold consecutive failures, i.e. errors or server error responses,
+// the requests to an endpoint fail fast for the cooldown. Then a single
+// request is let through, closing the circuit if it succeeds, and opening
+// it for another cooldown if it fails. Queries passed on from clients
+// count too, as they load the same endpoints.
+type breakerTransport struct {
+	next      http.RoundTripper
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+// circuit is the state of the circuit breaker of an endpoint.
+type circuit struct {
+	failures  int
+	openUntil time.Time
+	// probing is set while the request probing whether the endpoint is
+	// back is in flight.
+	probing bool
+}
+
+func newBreakerTransport(next http.RoundTripper, threshold int, cooldown time.Duration) *breakerTransport {
+	return &breakerTransport{next: next, threshold: threshold, cooldown: cooldown, circuits: make(map[string]*circuit)}
+}
+
+// CloseIdleConnections closes the idle connections of the wrapped
+// transport.
+func (t *breakerTransport) CloseIdleConnections() {
+	closeIdleConnections(t.next)
+}
+
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	t.mu.Lock()
+	c, ok := t.circuits[host]
+	if !ok {
+		c = &circuit{}
+		t.circuits[host] = c
+	}
+	probe := false
+	if c.failures >= t.threshold {
+		if wait := time.Until(c.openUntil); wait > 0 || c.probing {
+			t.mu.Unlock()
+			if wait < time.Second {
+				wait = time.Second
+			}
+			return nil, endpointDownError{host: host, retryAfter: wait.Round(time.Second)}
+		}
+		probe, c.probing = true, true
+	}
+	t.mu.Unlock()
+
+	resp, err := t.next.RoundTrip(req)
+	// Requests canceled by the client say nothing about the endpoint.
+	canceled := err != nil && req.Context().Err() != nil
+	failed := err != nil && !canceled || err == nil && resp.StatusCode >= 500
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if probe {
+		c.probing = false
+	}
+	switch {
+	case canceled:
+	case failed:
+		c.failures++
+		if c.failures >= t.threshold {
+			if c.failures == t.threshold || probe {
+				log.Printf("%s: %d failures, failing requests for %v", host, c.failures, t.cooldown)
+			}
+			c.openUntil = time.Now().Add(t.cooldown)
+		}
+	default:
+		if c.failures >= t.threshold {
+			log.Printf("%s: recovered", host)
+		}
+		c.failures = 0
+	}
+	return resp, err
+}
+
+// upstreamStatus returns the status of the response to a request failing
+// with the error err of a query: 503, with a Retry-After header, if the
+// endpoint is down, or else status.
+func upstreamStatus(w http.ResponseWriter, err error, status int) int {
+	if ue, ok := err.(*url.Error); ok {
+		err = ue.Err
+	}
+	if down, ok := err.(endpointDownError); ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(down.retryAfter.Seconds())))
+		return http.StatusServiceUnavailable
+	}
+	return status
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// browsePath is where the resources of the browsable classes are listed,
+// under the name of the class.
+const browsePath = "/browse"
+
+const browseQuery = `SELECT ?s (SAMPLE(?l) AS ?label) (MAX(?m) AS ?modified) WHERE { ?s a <%s> %s %s } GROUP BY ?s ORDER BY %s LIMIT %d OFFSET %d`
+
+// browseOrders are the orderings of the browse pages, selected by the
+// sort parameter. The first is the default.
+var browseOrders = []string{"label", "modified"}
+
+// serveBrowse serves a page of the resources in the default graph of the
+// class named by the path, ordered by label or, with sort=modified, by
+// modification time. /browse itself lists the browsable classes.
+func (srv server) serveBrowse(w http.ResponseWriter, r *http.Request) {
+	f, _ := formatByName("html")
+	rt := srv.routes[len(srv.routes)-1]
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, browsePath), "/")
+
+	var body bytes.Buffer
+	if name == "" {
+		names := make([]string, 0, len(srv.browse.Classes))
+		for name := range srv.browse.Classes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		body.WriteString("<ul>\n")
+		for _, name := range names {
+			fmt.Fprintf(&body, "<li><a href=\"%s\">%s</a></li>\n", html.EscapeString(browsePath+"/"+url.PathEscape(name)), html.EscapeString(name))
+		}
+		body.WriteString("</ul>\n")
+		srv.writeBrowsePage(w, "Browse", body.String())
+		return
+	}
+
+	class, ok := srv.browse.Classes[name]
+	if !ok {
+		srv.serveError(w, f, http.StatusNotFound, fmt.Sprintf("There is no class %q to browse.", name), nil)
+		return
+	}
+	order := r.FormValue("sort")
+	if order == "" {
+		order = browseOrders[0]
+	}
+	var labels, modified, orderBy string
+	if len(srv.labels) > 0 {
+		labels = "OPTIONAL { ?s ?p ?l FILTER (?p IN (" + srv.labelPredicates() + ")) }"
+	}
+	if srv.modified != "" {
+		modified = "OPTIONAL { ?s <" + srv.modified + "> ?m }"
+	}
+	switch {
+	case order == "label" && labels != "":
+		orderBy = "?label ?s"
+	case order == "label":
+		orderBy = "?s"
+	case order == "modified" && modified != "":
+		orderBy = "DESC(?modified) ?s"
+	default:
+		http.Error(w, fmt.Sprintf("unknown sort order: %q", order), http.StatusBadRequest)
+		return
+	}
+
+	page := requestedPage(r)
+	// One more result than shown is asked for, to know whether there is a
+	// next page.
+	q := fmt.Sprintf(browseQuery, class, labels, modified, orderBy, srv.browse.PageSize+1, (page-1)*srv.browse.PageSize)
+	rows, err := selectRows(srv.reqContext(), srv.endpoints[0], rt.graph, q)
+	if err != nil {
+		srv.serveError(w, f, upstreamStatus(w, err, http.StatusInternalServerError), err.Error(), nil)
+		return
+	}
+	more := len(rows) > srv.browse.PageSize
+	if more {
+		rows = rows[:srv.browse.PageSize]
+	}
+
+	path := browsePath + "/" + url.PathEscape(name)
+	if modified != "" {
+		body.WriteString("<p>Sort by")
+		for _, o := range browseOrders {
+			if o == order {
+				fmt.Fprintf(&body, " <strong>%s</strong>", o)
+			} else {
+				fmt.Fprintf(&body, " <a href=\"%s\">%s</a>", html.EscapeString(browsePageURL(path, o, 1)), o)
+			}
+		}
+		body.WriteString("</p>\n")
+	}
+	if len(rows) == 0 {
+		body.WriteString("<p>No resources.</p>\n")
+	}
+	writeResourceList(&body, htmlStyle{srv: srv, rt: rt}, rows, (page-1)*srv.browse.PageSize)
+	var prev, next string
+	if page > 1 {
+		prev = browsePageURL(path, order, page-1)
+	}
+	if more {
+		next = browsePageURL(path, order, page+1)
+	}
+	writePager(&body, prev, next)
+	srv.writeBrowsePage(w, "Browse: "+name, body.String())
+}
+
+// writeBrowsePage writes a browse page with the given title and body.
+func (srv server) writeBrowsePage(w http.ResponseWriter, title, body string) {
+	f, _ := formatByName("html")
+	w.Header().Set("Content-Type", f.contentType())
+	err := srv.writeHTMLPage(w, "browse", htmlPage{
+		Title: title,
+		Body:  template.HTML(body),
+	})
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// browsePageURL returns the URL of the given page of the browse page at
+// path, in the given order.
+func browsePageURL(path, order string, page int) string {
+	return path + "?" + url.Values{"sort": {order}, "page": {strconv.Itoa(page)}}.Encode()
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/knakk/kbp/rdf"
+)
+
+// descriptionCache caches the descriptions of resources, so that popular
+// resources are not fetched from the backend on every view. Resources
+// found not to exist are cached as empty descriptions, for a shorter
+// while. Expired descriptions are kept for the staleness window, to be
+// served while they are refreshed.
+type descriptionCache interface {
+	// get returns a copy of the cached description of the resource, if
+	// it is cached, and whether it is stale, i.e. expired but within the
+	// staleness window.
+	get(res resolution) (trs []rdf.Triple, stale, ok bool)
+	// add caches a copy of the description of the resource.
+	add(res resolution, trs []rdf.Triple)
+	// evictURIs and evictGraph remove the cached descriptions of the
+	// resources, or of all resources of the graph, and return how many
+	// there were.
+	evictURIs(uris []string) (int, error)
+	evictGraph(graph string) (int, error)
+}
+
+// newDescriptionCache returns the configured cache: shared in Redis, if
+// configured, or else in memory.
+func newDescriptionCache(cfg cacheConfig) descriptionCache {
+	if cfg.Redis != "" {
+		return newRedisCache(cfg)
+	}
+	return newMemoryCache(cfg)
+}
+
+// memoryCache caches descriptions in memory. The least recently used
+// descriptions are evicted when it is full.
+type memoryCache struct {
+	cfg cacheConfig
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// lru orders the entries from the most to the least recently used.
+	lru *list.List
+}
+
+// invalidatePath is where cached descriptions are evicted, given by the
+// URIs of the resources or their graph.
+const invalidatePath = "/invalidate"
+
+type cacheEntry struct {
+	key        string
+	uri, graph string
+	trs        []rdf.Triple
+	fetched    time.Time
+}
+
+func newMemoryCache(cfg cacheConfig) *memoryCache {
+	return &memoryCache{cfg: cfg, entries: make(map[string]*list.Element), lru: list.New()}
+}
+
+// cacheKey identifies the description of the resource by the query
+// describing it and the graph queried.
+func cacheKey(res resolution) string {
+	return res.graph + "\n" + res.query
+}
+
+// ttl returns how long the description trs is cached: the TTL, or the TTL
+// of resources not found if it is empty.
+func (cfg cacheConfig) ttl(trs []rdf.Triple) time.Duration {
+	if len(trs) == 0 {
+		return cfg.NotFoundTTL
+	}
+	return cfg.TTL
+}
+
+func (c *memoryCache) get(res resolution) ([]rdf.Triple, bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[cacheKey(res)]
+	if !ok {
+		return nil, false, false
+	}
+	e := el.Value.(*cacheEntry)
+	age, ttl := time.Since(e.fetched), c.cfg.ttl(e.trs)
+	if age >= ttl+c.cfg.Stale {
+		c.lru.Remove(el)
+		delete(c.entries, e.key)
+		return nil, false, false
+	}
+	c.lru.MoveToFront(el)
+	return append([]rdf.Triple(nil), e.trs...), age >= ttl, true
+}
+
+// add caches a copy of the description of the resource, evicting the
+// least recently used description if the cache is full. Empty
+// descriptions are only cached if the TTL of resources not found is set.
+func (c *memoryCache) add(res resolution, trs []rdf.Triple) {
+	if c.cfg.ttl(trs) == 0 {
+		return
+	}
+	e := &cacheEntry{key: cacheKey(res), uri: res.uri, graph: res.graph, trs: append([]rdf.Triple(nil), trs...), fetched: time.Now()}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[e.key]; ok {
+		el.Value = e
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[e.key] = c.lru.PushFront(e)
+	for c.lru.Len() > c.cfg.Size {
+		last := c.lru.Back()
+		c.lru.Remove(last)
+		delete(c.entries, last.Value.(*cacheEntry).key)
+	}
+}
+
+func (c *memoryCache) evictURIs(uris []string) (int, error) {
+	evicted := make(map[string]bool, len(uris))
+	for _, uri := range uris {
+		evicted[uri] = true
+	}
+	return c.evict(func(e *cacheEntry) bool { return evicted[e.uri] }), nil
+}
+
+func (c *memoryCache) evictGraph(graph string) (int, error) {
+	return c.evict(func(e *cacheEntry) bool { return e.graph == graph }), nil
+}
+
+// evict removes the cached descriptions for which match is true, and
+// returns how many there were.
+func (c *memoryCache) evict(match func(e *cacheEntry) bool) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for el := c.lru.Front(); el != nil; {
+		next := el.Next()
+		if e := el.Value.(*cacheEntry); match(e) {
+			c.lru.Remove(el)
+			delete(c.entries, e.key)
+			n++
+		}
+		el = next
+	}
+	return n
+}
+
+// serveInvalidate evicts cached descriptions, so that changes to the
+// data are visible at once: those of the resources whose URIs are posted
+// as a JSON list, or all of those of the graph parameter. The request
+// must carry the invalidation token as a bearer token.
+func (srv server) serveInvalidate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	token := []byte("Bearer " + srv.invalidateToken)
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), token) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="vindu"`)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+		return
+	}
+	var n int
+	var err error
+	if graph, ok := r.URL.Query()["graph"]; ok {
+		n, err = srv.cache.evictGraph(graph[0])
+	} else {
+		var uris []string
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&uris); err != nil {
+			http.Error(w, fmt.Sprintf("invalid JSON list of URIs: %v", err), http.StatusBadRequest)
+			return
+		}
+		n, err = srv.cache.evictURIs(uris)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	fmt.Fprintf(w, "%d descriptions evicted\n", n)
+}
+
+// revalidate refreshes the stale description of the resource in the
+// background, unless it is being refreshed already. The refresh is not
+// canceled with the request serving the stale description.
+func (srv server) revalidate(res resolution) {
+	key := cacheKey(res)
+	if _, busy := srv.revalidating.LoadOrStore(key, true); busy {
+		return
+	}
+	go func() {
+		defer srv.revalidating.Delete(key)
+		srv.ctx = withQueryTimeout(context.Background(), srv.queryTimeout)
+		trs, err := srv.fetchDescription(res)
+		if err != nil {
+			log.Printf("revalidating %s: %v", res.uri, err)
+			return
+		}
+		srv.cache.add(res, trs)
+	}()
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// redirectCanonical redirects requests for non-canonical paths, e.g. with
+// trailing or duplicate slashes, dot segments or needlessly percent-encoded
+// characters, permanently to the canonical path. It returns true if the
+// request was redirected.
+func (srv server) redirectCanonical(w http.ResponseWriter, r *http.Request) bool {
+	canonical := canonicalPath(r.URL.EscapedPath())
+	if canonical == r.URL.EscapedPath() {
+		return false
+	}
+	if r.URL.RawQuery != "" {
+		canonical += "?" + r.URL.RawQuery
+	}
+	http.Redirect(w, r, srv.absURL(r, canonical), http.StatusMovedPermanently)
+	return true
+}
+
+// canonicalPath returns the canonical form of the escaped path. Its
+// segments are normalized one by one, so that encoded slashes, which are
+// part of a segment, are left encoded.
+func canonicalPath(escaped string) string {
+	segs := strings.Split(escaped, "/")
+	for i, seg := range segs {
+		if s, err := url.PathUnescape(seg); err == nil {
+			segs[i] = strings.Replace((&url.URL{Path: s}).EscapedPath(), "/", "%2F", -1)
+		}
+	}
+	return path.Clean("/" + strings.Join(segs, "/"))
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/golang/gddo/httputil"
+)
+
+// compress wraps h, compressing successful responses with gzip or
+// deflate as negotiated by the Accept-Encoding header.
+func compress(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		enc := httputil.NegotiateContentEncoding(r, []string{"gzip", "deflate"})
+		if enc != "gzip" && enc != "deflate" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		// The entity tags of compressed responses are suffixed with the
+		// encoding, and the suffix is removed from conditional requests.
+		if inm := r.Header.Get("If-None-Match"); inm != "" {
+			r.Header.Set("If-None-Match", strings.Replace(inm, "-"+enc+`"`, `"`, -1))
+		}
+		cw := &compressWriter{ResponseWriter: w, encoding: enc, head: r.Method == "HEAD"}
+		defer cw.close()
+		h.ServeHTTP(cw, r)
+	})
+}
+
+// compressWriter compresses the response body if the response is a
+// 200 OK not already encoded.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	head        bool
+	w           io.WriteCloser
+	wroteHeader bool
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	h := cw.Header()
+	if etag := h.Get("ETag"); (code == http.StatusOK || code == http.StatusNotModified) && strings.HasSuffix(etag, `"`) && h.Get("Content-Encoding") == "" {
+		h.Set("ETag", strings.TrimSuffix(etag, `"`)+"-"+cw.encoding+`"`)
+	}
+	if code == http.StatusOK && h.Get("Content-Encoding") == "" {
+		h.Set("Content-Encoding", cw.encoding)
+		// The length of the compressed body is not known up front.
+		h.Del("Content-Length")
+		if !cw.head {
+			if cw.encoding == "gzip" {
+				cw.w = gzip.NewWriter(cw.ResponseWriter)
+			} else {
+				cw.w = zlib.NewWriter(cw.ResponseWriter)
+			}
+		}
+	}
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.w != nil {
+		return cw.w.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// close flushes the compressed body. Responses with no body written,
+// such as to HEAD requests, get the headers of the compressed response.
+func (cw *compressWriter) close() {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.w != nil {
+		cw.w.Close()
+	}
+}
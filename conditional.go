@@ -0,0 +1,91 @@
+package main
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/knakk/kbp/rdf"
+)
+
+// etag returns the entity tag of the representation of trs in the format
+// f, as a hash of the sorted triples.
+func etag(f outputFormat, trs []rdf.Triple) string {
+	lines := make([]string, len(trs))
+	for i, tr := range trs {
+		lines[i] = ntriple(tr)
+	}
+	sort.Strings(lines)
+	h := sha1.New()
+	io.WriteString(h, f.mediaType+"\n")
+	for _, l := range lines {
+		io.WriteString(h, l+"\n")
+	}
+	return fmt.Sprintf(`"%x"`, h.Sum(nil))
+}
+
+// noneMatch reports whether the If-None-Match header of r does not match
+// the entity tag, i.e. whether the representation should be sent. Weak
+// comparison is used, as required for If-None-Match.
+func noneMatch(r *http.Request, tag string) bool {
+	for _, h := range r.Header["If-None-Match"] {
+		for _, t := range strings.Split(h, ",") {
+			t = strings.TrimSpace(t)
+			if t == "*" || strings.TrimPrefix(t, "W/") == strings.TrimPrefix(tag, "W/") {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// lastModified returns the latest modification time of the resource,
+// given by the modification predicate. ok is false if it has none.
+func (srv server) lastModified(res resolution, trs []rdf.Triple) (t time.Time, ok bool) {
+	if srv.modified == "" {
+		return t, false
+	}
+	node := rdf.NewNamedNode(res.uri)
+	for _, tr := range trs {
+		if tr.Subject != node || tr.Predicate.Name() != srv.modified {
+			continue
+		}
+		l, isLit := tr.Object.(rdf.Literal)
+		if !isLit {
+			continue
+		}
+		m, err := time.Parse(time.RFC3339Nano, l.ValueAsString())
+		if err != nil {
+			// xsd:dateTime allows omitting the time zone.
+			if m, err = time.Parse("2006-01-02T15:04:05.999999999", l.ValueAsString()); err != nil {
+				continue
+			}
+		}
+		if m.After(t) {
+			t, ok = m, true
+		}
+	}
+	return t, ok
+}
+
+// notModified reports whether the conditional request r can be answered
+// with 304 Not Modified, given the entity tag and, if known, modification
+// time of the representation. If-Modified-Since is ignored when
+// If-None-Match is given.
+func notModified(r *http.Request, tag string, modified time.Time, known bool) bool {
+	if _, ok := r.Header["If-None-Match"]; ok {
+		return !noneMatch(r, tag)
+	}
+	if !known {
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	return !modified.Truncate(time.Second).After(since)
+}
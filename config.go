@@ -0,0 +1,879 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// config holds all server settings. See resolveConfig for how the
+// settings are gathered.
+type config struct {
+	// Graph is the graph exposed. Several graphs separated by whitespace
+	// expose their union, and "*" the union of all graphs of the
+	// endpoint, so that resources with triples in more than one graph
+	// are described in full. The same goes for the graphs of mounts.
+	Graph    string           `yaml:"graph" toml:"graph"`
+	Graphs   map[string]mount `yaml:"graphs" toml:"graphs"`
+	Base     string           `yaml:"base" toml:"base"`
+	Endpoint string           `yaml:"endpoint" toml:"endpoint"`
+	// Backend is the store describing the resources: "virtuoso",
+	// "sparql" for other SPARQL 1.1 endpoints, or "memory" for the
+	// N-Triples files of Data, loaded on start. The memory backend only
+	// describes resources, so incoming links, labels, tables,
+	// breadcrumbs, search, browsing, feeds, diagrams, the SPARQL
+	// endpoint and exports are turned off with it.
+	Backend string   `yaml:"backend" toml:"backend"`
+	Data    []string `yaml:"data" toml:"data"`
+	// Federation lists additional endpoints queried along with Endpoint.
+	// Their results are merged.
+	Federation []string `yaml:"federation" toml:"federation"`
+	// DescribeMode is the Virtuoso describe mode used for DESCRIBE
+	// queries, e.g. CBD, SCBD or LCBD.
+	DescribeMode string `yaml:"describe_mode" toml:"describe_mode"`
+	// StartupCheck makes vindu verify that the endpoints are reachable
+	// and the graphs exist on startup. It is on by default, and turned
+	// off with startup_check: false or -startup-check=false.
+	StartupCheck bool `yaml:"startup_check" toml:"startup_check"`
+	// Check makes vindu check the endpoints and exit.
+	Check bool `yaml:"-" toml:"-"`
+	// Queries are custom queries used instead of DESCRIBE for matching
+	// resources. The first matching query is used.
+	Queries []queryConfig `yaml:"queries" toml:"queries"`
+	// Rewrites are applied to request paths before they are resolved.
+	Rewrites []rewriteConfig `yaml:"rewrites" toml:"rewrites"`
+
+	// Listen lists the addresses to serve resources on. An address is a
+	// TCP address, or unix:/path/to/socket.
+	Listen []string `yaml:"listen" toml:"listen"`
+	// AdminListen lists the addresses to serve the admin handlers on,
+	// e.g. for toggling maintenance mode, reloading and profiling.
+	AdminListen []string `yaml:"admin_listen" toml:"admin_listen"`
+	// SocketMode is the octal file mode of the unix domain socket, if any.
+	SocketMode string         `yaml:"socket_mode" toml:"socket_mode"`
+	TLSCert    string         `yaml:"tls_cert" toml:"tls_cert"`
+	TLSKey     string         `yaml:"tls_key" toml:"tls_key"`
+	Autocert   autocertConfig `yaml:"autocert" toml:"autocert"`
+	// ErrorTemplate is a file with a html/template for error pages, used
+	// instead of the built-in one. See errorPage for the data available.
+	ErrorTemplate string `yaml:"error_template" toml:"error_template"`
+	// SearchURL is linked to from the page of missing resources, with the
+	// identifier of the resource in place of {{query}}.
+	SearchURL string `yaml:"search_url" toml:"search_url"`
+	// SearchPageSize is the number of results per page of the full-text
+	// search of labels at /search, which is linked to from the HTML
+	// views. 0 disables the search.
+	SearchPageSize int `yaml:"search_page_size" toml:"search_page_size"`
+	// TrustedProxies lists the IP addresses or CIDR networks of reverse
+	// proxies, whose X-Forwarded-Proto and X-Forwarded-Host headers are
+	// used when constructing absolute URLs.
+	TrustedProxies []string `yaml:"trusted_proxies" toml:"trusted_proxies"`
+	// CORS configures cross-origin requests.
+	CORS corsConfig `yaml:"cors" toml:"cors"`
+	// ShutdownTimeout is how long in-flight requests are given to
+	// complete on shutdown.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+	// MaintenanceRetryAfter is when clients are told to retry in
+	// maintenance mode.
+	MaintenanceRetryAfter time.Duration `yaml:"maintenance_retry_after" toml:"maintenance_retry_after"`
+
+	Prefixes map[string]string `yaml:"prefixes" toml:"prefixes"`
+	// PrefixFile is a file or URL with additional prefixes, in one of the
+	// formats offered by prefix.cc. Prefixes in Prefixes take precedence.
+	PrefixFile string `yaml:"prefix_file" toml:"prefix_file"`
+	// Linkify lists regular expressions matching the resource URIs to
+	// render as links in the HTML view. The expressions are matched
+	// against the start of the URI relative to the base URI.
+	Linkify []string `yaml:"linkify" toml:"linkify"`
+	// PredicateOrder lists the predicates, as IRIs or prefixed names,
+	// which are listed first in the descriptions, in order. The other
+	// predicates follow alphabetically by prefixed name.
+	PredicateOrder []string `yaml:"predicate_order" toml:"predicate_order"`
+	// Images lists the predicates, as IRIs or prefixed names, whose
+	// objects are image URLs, shown as thumbnails in the HTML view.
+	Images []string `yaml:"images" toml:"images"`
+	// Labels lists the predicates, as IRIs or prefixed names, giving the
+	// labels shown next to links in the HTML view, in order of
+	// preference. The labels are looked up in the first endpoint.
+	Labels []string `yaml:"labels" toml:"labels"`
+	// Modified is the predicate giving the modification time of resources,
+	// as an IRI or prefixed name, used for the Last-Modified header. Its
+	// values should be xsd:dateTime literals.
+	Modified string `yaml:"modified" toml:"modified"`
+	// Dereference configures 303 redirects of non-information resources.
+	Dereference derefConfig `yaml:"dereference" toml:"dereference"`
+	// SchemaOrg maps classes and properties to schema.org, for the
+	// structured data embedded in HTML pages.
+	SchemaOrg schemaConfig `yaml:"schema_org" toml:"schema_org"`
+	// MARC maps properties to MARC 21 fields, for the MARCXML output of
+	// publications.
+	MARC []marcConfig `yaml:"marc" toml:"marc"`
+	// Geo configures the coordinates of the GeoJSON output.
+	Geo geoConfig `yaml:"geo" toml:"geo"`
+	// DefaultFormat is the output format used when the client accepts any
+	// format, e.g. text/plain, html or turtle. It is given as a media type
+	// or a format name of the format query parameter.
+	DefaultFormat string `yaml:"default_format" toml:"default_format"`
+	// HTMLMode selects the HTML rendering: "turtle" renders the triples
+	// as Turtle, "microdata" renders the schema.org mapping as microdata,
+	// for resources with a mapped type.
+	HTMLMode string `yaml:"html_mode" toml:"html_mode"`
+	// HTMLTemplates is a directory with html/template files (*.html)
+	// redefining the built-in templates of the HTML views, e.g. "header"
+	// and "footer". See htmlPage for the data available.
+	HTMLTemplates string `yaml:"html_templates" toml:"html_templates"`
+	// StaticDir is a directory with static assets served under /static/,
+	// e.g. logos for the templates. A vindu.css in it replaces the
+	// built-in stylesheet.
+	StaticDir string `yaml:"static_dir" toml:"static_dir"`
+	// TurtleShorthand makes the Turtle and HTML views write integers,
+	// decimals, doubles and booleans without quotes and datatype.
+	TurtleShorthand bool `yaml:"turtle_shorthand" toml:"turtle_shorthand"`
+	// HDTTool is the command converting N-Triples to HDT, for the
+	// export on the admin listeners.
+	HDTTool string `yaml:"hdt_tool" toml:"hdt_tool"`
+	// ExportDir is a directory where HDT exports are kept, so that
+	// interrupted downloads can be resumed. Exports are regenerated
+	// when requested with refresh=true. If empty, they are generated
+	// for each request.
+	ExportDir string `yaml:"export_dir" toml:"export_dir"`
+	// Feed configures the Atom feed of recently modified resources.
+	Feed feedConfig `yaml:"feed" toml:"feed"`
+	// PropertyLabels configures the label view of the HTML view, showing
+	// properties by their labels rather than prefixed names.
+	PropertyLabels propertyLabelConfig `yaml:"property_labels" toml:"property_labels"`
+	// Preview configures the hover cards of the HTML view, showing the
+	// labels of external resources.
+	Preview previewConfig `yaml:"preview" toml:"preview"`
+	// Cache configures the cache of the descriptions of resources.
+	Cache cacheConfig `yaml:"cache" toml:"cache"`
+	// Upstream configures the timeouts and authentication of the
+	// requests to the SPARQL endpoints.
+	Upstream upstreamConfig `yaml:"upstream" toml:"upstream"`
+	// SPARQL configures the read-only SPARQL endpoint at /sparql.
+	SPARQL sparqlConfig `yaml:"sparql" toml:"sparql"`
+	// QueryPanel shows the query describing the resource in the HTML
+	// view.
+	QueryPanel queryPanelConfig `yaml:"query_panel" toml:"query_panel"`
+	// Branding names the deployment in the HTML pages.
+	Branding brandingConfig `yaml:"branding" toml:"branding"`
+	// QRCodes adds a QR code of the URI to the permalink of the HTML
+	// view, served from /qr.
+	QRCodes bool `yaml:"qr_codes" toml:"qr_codes"`
+	// Contents is the number of values from which the HTML view of a
+	// resource starts with a table of contents, linking to the anchors
+	// of its predicates; 0 disables it.
+	Contents int `yaml:"contents" toml:"contents"`
+	// VizLimit is the maximum number of links drawn in the neighborhood
+	// diagrams at /viz; 0 disables them.
+	VizLimit int `yaml:"viz_limit" toml:"viz_limit"`
+	// TripleLimit is the maximum number of triples of a description;
+	// longer descriptions are truncated and marked as such. 0 is no
+	// limit.
+	TripleLimit int `yaml:"triple_limit" toml:"triple_limit"`
+	// MaxRows is the maximum number of rows of the results of the
+	// endpoint, ResultSetMaxRows in virtuoso.ini. Descriptions coming
+	// back with as many triples are fetched again in pages, so that they
+	// are complete. 0 disables the paging.
+	MaxRows int `yaml:"max_rows" toml:"max_rows"`
+	// BatchSize is the maximum number of resources described at once at
+	// /batch; 0 disables it.
+	BatchSize int `yaml:"batch_size" toml:"batch_size"`
+	// Tables configures the tables of predicates with many values in the
+	// HTML view.
+	Tables tableConfig `yaml:"tables" toml:"tables"`
+	// Breadcrumbs configures the navigation at the top of the HTML view,
+	// e.g. from a publication to its work and the contributors of that.
+	Breadcrumbs breadcrumbConfig `yaml:"breadcrumbs" toml:"breadcrumbs"`
+	// Browse configures the pages listing the resources of classes.
+	Browse browseConfig `yaml:"browse" toml:"browse"`
+	// Incoming configures the listing of resources linking to the
+	// requested one.
+	Incoming incomingConfig `yaml:"incoming" toml:"incoming"`
+}
+
+func defaultConfig() config {
+	return config{
+		Graph:                 "lsext",
+		Endpoint:              "http://virtuoso:8890/sparql/",
+		Base:                  "http://data.deichman.no",
+		DescribeMode:          "CBD",
+		Backend:               backendVirtuoso,
+		StartupCheck:          true,
+		Listen:                []string{":7777"},
+		ShutdownTimeout:       30 * time.Second,
+		MaintenanceRetryAfter: 10 * time.Minute,
+		Prefixes: map[string]string{
+			"deich":     "http://data.deichman.no/ontology#",
+			"raw":       "http://data.deichman.no/raw#",
+			"migration": "http://migration.deichman.no/",
+			"duo":       "http://data.deichman.no/utility#",
+			"xsd":       "http://www.w3.org/2001/XMLSchema#",
+		},
+		Linkify:        []string{"place/", "publication/", "work/", "person/", "corporation/", "subject/", "genre/", "serial/"},
+		PredicateOrder: []string{"http://www.w3.org/1999/02/22-rdf-syntax-ns#type", "deich:name", "deich:mainTitle"},
+		Images:         []string{"http://schema.org/image", "http://xmlns.com/foaf/0.1/depiction"},
+		Labels:         []string{"http://www.w3.org/2000/01/rdf-schema#label", "deich:prefLabel", "deich:name", "deich:mainTitle"},
+		SchemaOrg: schemaConfig{
+			Classes: map[string]string{
+				"deich:Work":        "CreativeWork",
+				"deich:Publication": "Book",
+				"deich:Person":      "Person",
+				"deich:Corporation": "Organization",
+				"deich:Place":       "Place",
+				"deich:Serial":      "Periodical",
+				"deich:Subject":     "DefinedTerm",
+				"deich:Genre":       "DefinedTerm",
+			},
+			Properties: map[string]string{
+				"deich:mainTitle":       "name",
+				"deich:name":            "name",
+				"deich:prefLabel":       "name",
+				"deich:subtitle":        "alternativeHeadline",
+				"deich:publicationYear": "datePublished",
+				"deich:contributor":     "contributor",
+				"deich:subject":         "about",
+				"deich:genre":           "genre",
+				"deich:isbn":            "isbn",
+				"deich:language":        "inLanguage",
+				"deich:birthYear":       "birthDate",
+				"deich:deathYear":       "deathDate",
+				"deich:publicationOf":   "exampleOfWork",
+				"deich:publishedBy":     "publisher",
+				"deich:numberOfPages":   "numberOfPages",
+			},
+			Via: []string{"deich:agent"},
+		},
+		Modified: "deich:modified",
+		Dereference: derefConfig{
+			Page: "/page",
+			Data: "/data",
+		},
+		MARC: []marcConfig{
+			{Predicate: "deich:isbn", Tag: "020", Ind1: " ", Ind2: " ", Code: "a"},
+			{Predicate: "deich:language", Tag: "041", Ind1: " ", Ind2: " ", Code: "a", LocalName: true},
+			{Predicate: "deich:mainTitle", Tag: "245", Ind1: "1", Ind2: "0", Code: "a"},
+			{Predicate: "deich:subtitle", Tag: "245", Ind1: "1", Ind2: "0", Code: "b"},
+			{Predicate: "deich:publicationYear", Tag: "264", Ind1: " ", Ind2: "1", Code: "c"},
+			{Predicate: "deich:numberOfPages", Tag: "300", Ind1: " ", Ind2: " ", Code: "a"},
+			{Predicate: "deich:contributor", Tag: "700", Ind1: "1", Ind2: " ", Code: "0"},
+			{Predicate: "deich:publicationOf", Tag: "787", Ind1: "0", Ind2: " ", Code: "o"},
+		},
+		Geo: geoConfig{
+			Latitude:  "deich:latitude",
+			Longitude: "deich:longitude",
+		},
+		DefaultFormat: "text/plain",
+		HTMLMode:      htmlTurtle,
+		HDTTool:       "rdf2hdt",
+		Feed: feedConfig{
+			Predicate: "deich:modified",
+			Title:     "Deichman",
+			Size:      50,
+		},
+		SearchPageSize: 20,
+		PropertyLabels: propertyLabelConfig{
+			Lang: "en",
+			TTL:  time.Hour,
+		},
+		Preview: previewConfig{
+			TTL:       24 * time.Hour,
+			CacheSize: 10000,
+		},
+		Cache: cacheConfig{
+			TTL:         5 * time.Minute,
+			NotFoundTTL: 30 * time.Second,
+		},
+		Tables: tableConfig{
+			Threshold: 20,
+			Columns: []tableColumn{
+				{Title: "Year", Predicate: "deich:publicationYear"},
+				{Title: "Format", Predicate: "deich:format"},
+			},
+		},
+		Breadcrumbs: breadcrumbConfig{
+			Parent: "deich:publicationOf",
+			Agents: []string{"deich:contributor", "deich:agent"},
+			Limit:  5,
+		},
+		Browse: browseConfig{
+			Classes: map[string]string{
+				"work":        "deich:Work",
+				"publication": "deich:Publication",
+				"person":      "deich:Person",
+				"corporation": "deich:Corporation",
+				"place":       "deich:Place",
+				"serial":      "deich:Serial",
+				"subject":     "deich:Subject",
+				"genre":       "deich:Genre",
+			},
+			PageSize: 50,
+		},
+		Incoming: incomingConfig{
+			Limit: 50,
+		},
+		Upstream: upstreamConfig{
+			ConnectTimeout:  5 * time.Second,
+			ResponseTimeout: 60 * time.Second,
+			QueryTimeout:    30 * time.Second,
+			// Requests to the endpoints are many and short, so more
+			// connections than the default 2 are kept for reuse.
+			MaxIdleConns:        100,
+			MaxIdleConnsPerHost: 32,
+			IdleConnTimeout:     90 * time.Second,
+			Retries:             2,
+			RetryBackoff:        250 * time.Millisecond,
+			BreakerThreshold:    5,
+			BreakerCooldown:     30 * time.Second,
+		},
+		SPARQL: sparqlConfig{
+			Timeout: 30 * time.Second,
+			Limit:   10000,
+		},
+		Contents:  30,
+		VizLimit:  100,
+		BatchSize: 50,
+		MaxRows:   10000,
+	}
+}
+
+// load reads the config file at path into cfg. The format is decided
+// by the file extension. The tables of the file, i.e. the prefixes, the
+// schema.org classes and properties and the classes to browse, replace
+// the default ones rather than being merged with them, so that default
+// entries can be removed.
+func (cfg *config) load(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	tables := []*map[string]string{&cfg.Prefixes, &cfg.SchemaOrg.Classes, &cfg.SchemaOrg.Properties, &cfg.Browse.Classes}
+	defaults := make([]map[string]string, len(tables))
+	for i, t := range tables {
+		defaults[i], *t = *t, nil
+	}
+	defer func() {
+		for i, t := range tables {
+			if *t == nil {
+				*t = defaults[i]
+			}
+		}
+	}()
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalStrict(b, cfg)
+	case ".toml":
+		_, err = toml.Decode(string(b), cfg)
+	default:
+		return fmt.Errorf("config: unknown file format: %s", path)
+	}
+	if err != nil {
+		return fmt.Errorf("config: %s: %v", path, err)
+	}
+	return nil
+}
+
+// autocertConfig configures automatic certificates from Let's Encrypt.
+// It is enabled when any hosts are given.
+type autocertConfig struct {
+	Hosts []string `yaml:"hosts" toml:"hosts"`
+	Email string   `yaml:"email" toml:"email"`
+	// Cache is a directory where certificates are stored between restarts.
+	Cache string `yaml:"cache" toml:"cache"`
+}
+
+// corsConfig configures Cross-Origin Resource Sharing. It is disabled
+// unless any origins are given.
+type corsConfig struct {
+	// Origins lists the allowed origins, e.g. https://example.org, or *
+	// to allow any origin.
+	Origins []string `yaml:"origins" toml:"origins"`
+	// MaxAge is how long browsers may cache the answer to a preflight
+	// request.
+	MaxAge time.Duration `yaml:"max_age" toml:"max_age"`
+}
+
+// schemaConfig maps classes and properties, given as IRIs or prefixed
+// names, to schema.org types and properties.
+type schemaConfig struct {
+	Classes    map[string]string `yaml:"classes" toml:"classes"`
+	Properties map[string]string `yaml:"properties" toml:"properties"`
+	// Via lists properties of blank nodes whose value is used in place of
+	// the blank node, e.g. the agent of a contribution.
+	Via []string `yaml:"via" toml:"via"`
+}
+
+// derefConfig configures dereferencing of non-information resources, as
+// in "Cool URIs for the Semantic Web". Requests for resources matching
+// Things are redirected with 303 See Other to the HTML page describing
+// them under the Page prefix, or to the data describing them under the
+// Data prefix, depending on the negotiated format.
+type derefConfig struct {
+	// Things lists regular expressions matching the start of the URIs of
+	// non-information resources, relative to the base URI. Redirects are
+	// disabled if it is empty.
+	Things []string `yaml:"things" toml:"things"`
+	Page   string   `yaml:"page" toml:"page"`
+	Data   string   `yaml:"data" toml:"data"`
+}
+
+// marcConfig maps the values of Predicate, an IRI or prefixed name, to a
+// subfield of a MARC 21 data field. With LocalName, IRIs are mapped to
+// their last path segment or fragment, e.g. language codes.
+type marcConfig struct {
+	Predicate string `yaml:"predicate" toml:"predicate"`
+	Tag       string `yaml:"tag" toml:"tag"`
+	Ind1      string `yaml:"ind1" toml:"ind1"`
+	Ind2      string `yaml:"ind2" toml:"ind2"`
+	Code      string `yaml:"code" toml:"code"`
+	LocalName bool   `yaml:"local_name" toml:"local_name"`
+}
+
+// geoConfig gives the predicates of the WGS 84 latitude and longitude of
+// resources, as IRIs or prefixed names.
+type geoConfig struct {
+	Latitude  string `yaml:"latitude" toml:"latitude"`
+	Longitude string `yaml:"longitude" toml:"longitude"`
+}
+
+// feedConfig configures the Atom feed served at /feed. The feed is
+// disabled if Predicate is empty.
+type feedConfig struct {
+	// Predicate is the modification time of resources, given as an IRI or
+	// prefixed name. Its values should be xsd:dateTime literals.
+	Predicate string `yaml:"predicate" toml:"predicate"`
+	Title     string `yaml:"title" toml:"title"`
+	// Size is the number of entries in the feed.
+	Size int `yaml:"size" toml:"size"`
+}
+
+// propertyLabelConfig configures the label view, which users can switch
+// to from the Turtle view of the HTML view. It is disabled if Graph is
+// empty.
+type propertyLabelConfig struct {
+	// Graph is the graph with the ontology, where the properties have
+	// rdfs:label.
+	Graph string `yaml:"graph" toml:"graph"`
+	// Lang is the preferred language of the labels.
+	Lang string `yaml:"lang" toml:"lang"`
+	// TTL is how long the labels are cached.
+	TTL time.Duration `yaml:"ttl" toml:"ttl"`
+}
+
+// previewConfig configures the hover cards of external resources, whose
+// labels are looked up by dereferencing them from vindu. They are
+// disabled unless any hosts are given.
+type previewConfig struct {
+	// Hosts lists the hosts, including their subdomains, of the external
+	// resources which may be dereferenced, e.g. viaf.org.
+	Hosts []string `yaml:"hosts" toml:"hosts"`
+	// TTL is how long the labels are cached.
+	TTL time.Duration `yaml:"ttl" toml:"ttl"`
+	// CacheSize is the maximum number of labels cached.
+	CacheSize int `yaml:"cache_size" toml:"cache_size"`
+}
+
+// cacheConfig configures the cache of the descriptions of resources, so
+// that resources viewed often, e.g. those linked from a front page, are
+// not fetched from the endpoint every time. The least recently used
+// descriptions are evicted when it is full. It is disabled if Size is 0,
+// unless Redis is set.
+type cacheConfig struct {
+	// Redis is the URL of a Redis server, e.g. redis://cache:6379/0, to
+	// keep the cache in instead of memory, so that it is shared by the
+	// instances of vindu, and invalidated for all of them. The size is
+	// then left to the maxmemory settings of Redis.
+	Redis string `yaml:"redis" toml:"redis"`
+	// Size is the maximum number of descriptions cached.
+	Size int `yaml:"size" toml:"size"`
+	// TTL is how long descriptions are cached.
+	TTL time.Duration `yaml:"ttl" toml:"ttl"`
+	// NotFoundTTL is how long resources found not to exist are cached,
+	// so that requests for missing URIs, e.g. from bots, don't all reach
+	// the endpoint; 0 doesn't cache them.
+	NotFoundTTL time.Duration `yaml:"not_found_ttl" toml:"not_found_ttl"`
+	// Stale is how long descriptions are kept after they expire, to be
+	// served at once while they are refreshed in the background, so that
+	// a slow endpoint doesn't hold up requests; 0 refreshes them before
+	// serving.
+	Stale time.Duration `yaml:"stale" toml:"stale"`
+	// InvalidateToken is the bearer token of the requests to /invalidate
+	// evicting cached descriptions, e.g. from the cataloging system when
+	// records change. It is disabled if empty.
+	InvalidateToken string `yaml:"invalidate_token" toml:"invalidate_token"`
+}
+
+// tableConfig configures the tables of the HTML view, showing the values
+// of predicates with many values, e.g. the publications of a work, with
+// sortable columns. They are disabled if Threshold is 0.
+type tableConfig struct {
+	// Threshold is the number of values from which they are shown as a
+	// table.
+	Threshold int `yaml:"threshold" toml:"threshold"`
+	// Columns are the properties of the values shown, besides their
+	// labels.
+	Columns []tableColumn `yaml:"columns" toml:"columns"`
+}
+
+// tableColumn is a column of the value tables, showing the values of
+// Predicate, given as an IRI or prefixed name.
+type tableColumn struct {
+	Title     string `yaml:"title" toml:"title"`
+	Predicate string `yaml:"predicate" toml:"predicate"`
+}
+
+// breadcrumbConfig configures the breadcrumbs of the HTML view, shown
+// for resources with a parent. They are disabled if Parent is empty.
+type breadcrumbConfig struct {
+	// Parent is the predicate linking a resource to the resource above
+	// it, e.g. from a publication to its work, as an IRI or prefixed name.
+	Parent string `yaml:"parent" toml:"parent"`
+	// Agents is the path of predicates from the parent to its agents,
+	// e.g. the agents of the contributions to a work.
+	Agents []string `yaml:"agents" toml:"agents"`
+	// Limit is the maximum number of parents and agents looked up.
+	Limit int `yaml:"limit" toml:"limit"`
+}
+
+// browseConfig configures the browse pages at /browse/<name>, listing the
+// resources of the class given by the name. They are disabled if PageSize
+// is 0.
+type browseConfig struct {
+	// Classes maps names to classes, given as IRIs or prefixed names.
+	Classes map[string]string `yaml:"classes" toml:"classes"`
+	// PageSize is the number of resources per page.
+	PageSize int `yaml:"page_size" toml:"page_size"`
+}
+
+// upstreamConfig configures the requests to the SPARQL endpoints, and the
+// credentials and headers of secured endpoints.
+type upstreamConfig struct {
+	// ConnectTimeout limits how long connecting to an endpoint may take.
+	ConnectTimeout time.Duration `yaml:"connect_timeout" toml:"connect_timeout"`
+	// ResponseTimeout limits how long an endpoint may take to start
+	// responding to a query.
+	ResponseTimeout time.Duration `yaml:"response_timeout" toml:"response_timeout"`
+	// QueryTimeout is passed to Virtuoso as the timeout of the queries
+	// made to serve requests, so that it stops expensive queries on its
+	// own. Exports are not limited. 0 leaves it to the endpoint.
+	QueryTimeout time.Duration `yaml:"query_timeout" toml:"query_timeout"`
+	// MaxIdleConns and MaxIdleConnsPerHost limit the connections kept
+	// open for reuse, in total and per endpoint, and IdleConnTimeout how
+	// long they are kept. MaxConnsPerHost limits the connections to each
+	// endpoint, or is 0 for no limit.
+	MaxIdleConns        int           `yaml:"max_idle_conns" toml:"max_idle_conns"`
+	MaxIdleConnsPerHost int           `yaml:"max_idle_conns_per_host" toml:"max_idle_conns_per_host"`
+	MaxConnsPerHost     int           `yaml:"max_conns_per_host" toml:"max_conns_per_host"`
+	IdleConnTimeout     time.Duration `yaml:"idle_conn_timeout" toml:"idle_conn_timeout"`
+	// Retries is how many times queries failing with a server error, or
+	// without a response, are sent again, waiting RetryBackoff before the
+	// first retry and twice as long before each of the next, give or take
+	// half.
+	Retries      int           `yaml:"retries" toml:"retries"`
+	RetryBackoff time.Duration `yaml:"retry_backoff" toml:"retry_backoff"`
+	// BreakerThreshold is the number of consecutive failed queries,
+	// after retries, from which queries to an endpoint fail at once for
+	// BreakerCooldown, answered with 503 Service Unavailable. A single
+	// query then probes whether the endpoint is back. 0 disables the
+	// circuit breaker.
+	BreakerThreshold int           `yaml:"breaker_threshold" toml:"breaker_threshold"`
+	BreakerCooldown  time.Duration `yaml:"breaker_cooldown" toml:"breaker_cooldown"`
+	// Replicas are endpoints with copies of the data of the main
+	// endpoint, e.g. read replicas. Queries to the main endpoint fail
+	// over to them, in order, while it is down, or go to each of them in
+	// turn with Balance.
+	Replicas []string `yaml:"replicas" toml:"replicas"`
+	Balance  bool     `yaml:"balance" toml:"balance"`
+	// Auth is the authentication scheme used with Username and Password,
+	// "basic" or "digest", or empty for none.
+	Auth     string `yaml:"auth" toml:"auth"`
+	Username string `yaml:"username" toml:"username"`
+	Password string `yaml:"password" toml:"password"`
+	// Headers are added to the requests, e.g. the API key of a gateway.
+	Headers map[string]string `yaml:"headers" toml:"headers"`
+}
+
+// sparqlConfig configures the SPARQL endpoint of vindu, passing SELECT,
+// ASK and CONSTRUCT queries on to the first endpoint, so that tools can
+// query the exposed graphs without access to Virtuoso. Updates are
+// refused. The query editor at /query runs queries against it.
+type sparqlConfig struct {
+	Enabled bool `yaml:"enabled" toml:"enabled"`
+	// Timeout limits how long queries may run.
+	Timeout time.Duration `yaml:"timeout" toml:"timeout"`
+	// Limit is the maximum number of results of SELECT and CONSTRUCT
+	// queries. Queries without a LIMIT get it added, and queries asking
+	// for more are refused.
+	Limit int `yaml:"limit" toml:"limit"`
+}
+
+// queryPanelConfig configures the panel of the HTML view showing the
+// query describing the resource, with a link running it.
+type queryPanelConfig struct {
+	Enabled bool `yaml:"enabled" toml:"enabled"`
+	// Endpoint is the SPARQL endpoint the query is run against, as
+	// reachable from the browser. It defaults to the first endpoint.
+	Endpoint string `yaml:"endpoint" toml:"endpoint"`
+}
+
+// brandingConfig names the deployment, e.g. "Deichman linked data", in
+// the header, titles and footer of the HTML pages.
+type brandingConfig struct {
+	// Title is shown in the header and added to the titles of the pages.
+	Title string `yaml:"title" toml:"title"`
+	// Logo is the URL of an image shown in the header, e.g. of a file in
+	// the static directory.
+	Logo string `yaml:"logo" toml:"logo"`
+	// Footer is shown at the bottom of the pages, e.g. contact details.
+	Footer string `yaml:"footer" toml:"footer"`
+}
+
+// incomingConfig configures the "What links here" section of the HTML
+// view, listing the resources referencing the requested one. It is
+// disabled if Limit is 0.
+type incomingConfig struct {
+	// Limit is the maximum number of incoming links listed.
+	Limit int `yaml:"limit" toml:"limit"`
+	// RDF adds the incoming links to the other formats as well, as
+	// triples with the requested resource as object.
+	RDF bool `yaml:"rdf" toml:"rdf"`
+}
+
+// mount configures a graph exposed under a URL prefix.
+type mount struct {
+	Graph string `yaml:"graph" toml:"graph"`
+	// Base is the base URI of the resources in the graph. It defaults
+	// to the global base URI.
+	Base string `yaml:"base" toml:"base"`
+}
+
+// queryConfig configures a custom query for resources whose URI, relative
+// to the base URI, matches Pattern. The query is given inline or read from
+// File, and must be a graph query (DESCRIBE or CONSTRUCT). The resource
+// URI is injected where the query contains {{uri}}.
+type queryConfig struct {
+	Pattern string `yaml:"pattern" toml:"pattern"`
+	Query   string `yaml:"query" toml:"query"`
+	File    string `yaml:"file" toml:"file"`
+}
+
+// rewriteConfig rewrites request paths matching the regular expression
+// Pattern to Replacement, which may refer to submatches as $1 etc.
+type rewriteConfig struct {
+	Pattern     string `yaml:"pattern" toml:"pattern"`
+	Replacement string `yaml:"replacement" toml:"replacement"`
+}
+
+// listFlag is a flag.Value setting a list from comma separated values.
+type listFlag struct{ list *[]string }
+
+func (f listFlag) String() string {
+	if f.list == nil {
+		return ""
+	}
+	return strings.Join(*f.list, ",")
+}
+
+func (f listFlag) Set(v string) error {
+	*f.list = strings.Split(v, ",")
+	return nil
+}
+
+// graphsFlag is a flag.Value setting the mounted graphs of a config, on
+// the form prefix=graph or prefix=graph@base.
+type graphsFlag struct{ cfg *config }
+
+func (f graphsFlag) String() string {
+	if f.cfg == nil {
+		return ""
+	}
+	var mounts []string
+	for prefix, m := range f.cfg.Graphs {
+		if m.Base != "" {
+			mounts = append(mounts, prefix+"="+m.Graph+"@"+m.Base)
+		} else {
+			mounts = append(mounts, prefix+"="+m.Graph)
+		}
+	}
+	sort.Strings(mounts)
+	return strings.Join(mounts, ",")
+}
+
+func (f graphsFlag) Set(v string) error {
+	f.cfg.Graphs = make(map[string]mount)
+	for _, s := range strings.Split(v, ",") {
+		i := strings.Index(s, "=")
+		if i < 0 {
+			return fmt.Errorf("graph mount must be on the form prefix=graph: %q", s)
+		}
+		m := mount{Graph: s[i+1:]}
+		if j := strings.LastIndex(m.Graph, "@"); j >= 0 {
+			m.Graph, m.Base = m.Graph[:j], m.Graph[j+1:]
+		}
+		f.cfg.Graphs[s[:i]] = m
+	}
+	return nil
+}
+
+// envVars maps environment variables to the config fields they set.
+// VINDU_PORT is a shorthand for VINDU_LISTEN=:port, and is ignored if
+// VINDU_LISTEN is set too.
+var envVars = []struct {
+	name string
+	set  func(*config, string)
+}{
+	{"VINDU_GRAPH", func(cfg *config, v string) { cfg.Graph = v }},
+	{"VINDU_SPARQL_ENDPOINT", func(cfg *config, v string) { cfg.Endpoint = v }},
+	{"VINDU_DESCRIBE_MODE", func(cfg *config, v string) { cfg.DescribeMode = v }},
+	{"VINDU_BASE", func(cfg *config, v string) { cfg.Base = v }},
+	{"VINDU_LISTEN", func(cfg *config, v string) { cfg.Listen = strings.Split(v, ",") }},
+	{"VINDU_ADMIN_LISTEN", func(cfg *config, v string) { cfg.AdminListen = strings.Split(v, ",") }},
+	{"VINDU_PREFIXES", func(cfg *config, v string) { cfg.PrefixFile = v }},
+	{"VINDU_PORT", func(cfg *config, v string) {
+		if os.Getenv("VINDU_LISTEN") == "" {
+			cfg.Listen = []string{":" + v}
+		}
+	}},
+	{"VINDU_UPSTREAM_USERNAME", func(cfg *config, v string) { cfg.Upstream.Username = v }},
+	{"VINDU_UPSTREAM_PASSWORD", func(cfg *config, v string) { cfg.Upstream.Password = v }},
+	{"VINDU_INVALIDATE_TOKEN", func(cfg *config, v string) { cfg.Cache.InvalidateToken = v }},
+}
+
+// loadEnv overrides cfg with settings from VINDU_* environment variables.
+func (cfg *config) loadEnv() {
+	for _, env := range envVars {
+		if v := os.Getenv(env.name); v != "" {
+			env.set(cfg, v)
+		}
+	}
+}
+
+// resolveConfig gathers the server settings. In increasing order of
+// precedence, they are taken from:
+//
+//  1. built-in defaults
+//  2. the config file given by -config or VINDU_CONFIG
+//  3. VINDU_* environment variables
+//  4. command line flags
+//
+// It can be called again to reload the settings.
+func resolveConfig(args []string) (config, error) {
+	cfg := defaultConfig()
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	configFile := os.Getenv("VINDU_CONFIG")
+	fs.StringVar(&configFile, "config", configFile, "Config file (.yaml or .toml)")
+	fs.StringVar(&cfg.Graph, "graph", cfg.Graph, "Graph to expose; several graphs separated by spaces expose their union, and * all graphs")
+	fs.StringVar(&cfg.Endpoint, "sparq", cfg.Endpoint, "SPARQL endpoint address")
+	fs.StringVar(&cfg.Base, "base", cfg.Base, "Base URI of described resources")
+	fs.StringVar(&cfg.DescribeMode, "describe-mode", cfg.DescribeMode, "Virtuoso describe mode, e.g. CBD, SCBD or LCBD")
+	fs.StringVar(&cfg.Backend, "backend", cfg.Backend, "Store describing the resources: virtuoso, sparql for other SPARQL 1.1 endpoints, or memory")
+	fs.Var(listFlag{&cfg.Data}, "data", "Comma separated list of N-Triples files loaded by the memory backend")
+	fs.BoolVar(&cfg.StartupCheck, "startup-check", cfg.StartupCheck, "Check the SPARQL endpoints on startup; -startup-check=false skips it")
+	fs.BoolVar(&cfg.Check, "check", cfg.Check, "Check the SPARQL endpoints and exit")
+	fs.Var(listFlag{&cfg.Federation}, "federate", "Comma separated list of additional SPARQL endpoints to merge results from")
+	fs.Var(listFlag{&cfg.Listen}, "listen", "Comma separated list of addresses to listen on, e.g. localhost:7777 or unix:/var/run/vindu.sock")
+	fs.Var(listFlag{&cfg.AdminListen}, "admin-listen", "Comma separated list of addresses to serve admin and debug handlers on")
+	fs.StringVar(&cfg.SocketMode, "socket-mode", cfg.SocketMode, "File mode of the unix domain socket, e.g. 0660")
+	fs.StringVar(&cfg.TLSCert, "tls-cert", cfg.TLSCert, "TLS certificate file")
+	fs.StringVar(&cfg.TLSKey, "tls-key", cfg.TLSKey, "TLS key file")
+	fs.Var(listFlag{&cfg.Autocert.Hosts}, "autocert", "Comma separated list of hosts to get Let's Encrypt certificates for")
+	fs.StringVar(&cfg.Autocert.Cache, "autocert-cache", cfg.Autocert.Cache, "Directory to cache Let's Encrypt certificates in")
+	fs.Var(listFlag{&cfg.Dereference.Things}, "things", "Comma separated list of patterns for URIs of non-information resources to redirect with 303 See Other, relative to the base URI")
+	fs.Var(listFlag{&cfg.PredicateOrder}, "predicate-order", "Comma separated list of predicates to list first in descriptions")
+	fs.Var(listFlag{&cfg.Images}, "images", "Comma separated list of predicates whose objects are image URLs to show as thumbnails")
+	fs.Var(listFlag{&cfg.Labels}, "labels", "Comma separated list of predicates giving the labels of linked resources; empty disables the lookup")
+	fs.Var(listFlag{&cfg.Linkify}, "linkify", "Comma separated list of patterns for resource URIs to link to, relative to the base URI")
+	fs.StringVar(&cfg.DefaultFormat, "default-format", cfg.DefaultFormat, "Output format when the client accepts any, as a media type or format name")
+	fs.StringVar(&cfg.HTMLMode, "html-mode", cfg.HTMLMode, "HTML rendering: turtle or microdata")
+	fs.StringVar(&cfg.StaticDir, "static-dir", cfg.StaticDir, "Directory with static assets, e.g. a vindu.css replacing the built-in stylesheet")
+	fs.StringVar(&cfg.HTMLTemplates, "html-templates", cfg.HTMLTemplates, "Directory with HTML templates redefining the built-in ones")
+	fs.BoolVar(&cfg.TurtleShorthand, "turtle-shorthand", cfg.TurtleShorthand, "Write numbers and booleans without quotes in Turtle")
+	fs.StringVar(&cfg.PrefixFile, "prefixes", cfg.PrefixFile, "File or URL with prefixes in prefix.cc format")
+	fs.StringVar(&cfg.ErrorTemplate, "error-template", cfg.ErrorTemplate, "File with a HTML template for error pages")
+	fs.StringVar(&cfg.SearchURL, "search-url", cfg.SearchURL, "Search URL linked to from the page of missing resources, with {{query}} as placeholder")
+	fs.IntVar(&cfg.SearchPageSize, "search-page-size", cfg.SearchPageSize, "Results per page of the full-text search; 0 disables the search")
+	fs.Var(listFlag{&cfg.TrustedProxies}, "trusted-proxies", "Comma separated list of IP addresses or networks of trusted reverse proxies")
+	fs.Var(listFlag{&cfg.CORS.Origins}, "cors-origins", "Comma separated list of origins allowed to make cross-origin requests, or * for any")
+	fs.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", cfg.ShutdownTimeout, "Time to wait for in-flight requests on shutdown")
+	fs.DurationVar(&cfg.MaintenanceRetryAfter, "maintenance-retry-after", cfg.MaintenanceRetryAfter, "Retry-After given to clients in maintenance mode")
+	fs.StringVar(&cfg.HDTTool, "hdt-tool", cfg.HDTTool, "Command converting N-Triples to HDT, e.g. rdf2hdt from hdt-cpp")
+	fs.StringVar(&cfg.ExportDir, "export-dir", cfg.ExportDir, "Directory to keep HDT exports in, for resumable downloads")
+	fs.StringVar(&cfg.Feed.Predicate, "feed", cfg.Feed.Predicate, "Modification predicate of the Atom feed; empty disables the feed")
+	fs.StringVar(&cfg.PropertyLabels.Graph, "ontology-graph", cfg.PropertyLabels.Graph, "Graph with the labels of properties for the label view; empty disables the label view")
+	fs.StringVar(&cfg.Cache.Redis, "cache-redis", cfg.Cache.Redis, "URL of a Redis server to share the cache of descriptions in, e.g. redis://cache:6379/0")
+	fs.IntVar(&cfg.Cache.Size, "cache-size", cfg.Cache.Size, "Maximum number of descriptions of resources cached; 0 disables the cache")
+	fs.DurationVar(&cfg.Cache.TTL, "cache-ttl", cfg.Cache.TTL, "How long descriptions of resources are cached")
+	fs.DurationVar(&cfg.Cache.Stale, "cache-stale", cfg.Cache.Stale, "How long expired descriptions are served while they are refreshed; 0 refreshes them before serving")
+	fs.DurationVar(&cfg.Cache.NotFoundTTL, "cache-not-found-ttl", cfg.Cache.NotFoundTTL, "How long resources not found are cached; 0 doesn't cache them")
+	fs.Var(listFlag{&cfg.Preview.Hosts}, "preview-hosts", "Comma separated list of hosts of external resources to show hover cards for, e.g. viaf.org")
+	fs.DurationVar(&cfg.Upstream.ConnectTimeout, "upstream-connect-timeout", cfg.Upstream.ConnectTimeout, "Maximum time to connect to a SPARQL endpoint")
+	fs.DurationVar(&cfg.Upstream.ResponseTimeout, "upstream-timeout", cfg.Upstream.ResponseTimeout, "Maximum time for a SPARQL endpoint to start responding to a query")
+	fs.DurationVar(&cfg.Upstream.QueryTimeout, "query-timeout", cfg.Upstream.QueryTimeout, "Timeout of the queries serving requests, enforced by Virtuoso; 0 leaves it to the endpoint")
+	fs.IntVar(&cfg.Upstream.MaxIdleConnsPerHost, "upstream-idle-conns", cfg.Upstream.MaxIdleConnsPerHost, "Maximum number of idle connections kept open to each SPARQL endpoint")
+	fs.IntVar(&cfg.Upstream.MaxConnsPerHost, "upstream-max-conns", cfg.Upstream.MaxConnsPerHost, "Maximum number of connections to each SPARQL endpoint; 0 for no limit")
+	fs.IntVar(&cfg.Upstream.Retries, "upstream-retries", cfg.Upstream.Retries, "Number of times queries failing with transient errors are retried")
+	fs.IntVar(&cfg.Upstream.BreakerThreshold, "upstream-breaker", cfg.Upstream.BreakerThreshold, "Number of consecutive failed queries from which an endpoint is taken to be down for a while; 0 disables this")
+	fs.Var(listFlag{&cfg.Upstream.Replicas}, "replicas", "Comma separated list of SPARQL endpoints with copies of the data of the main endpoint, to fail over to")
+	fs.BoolVar(&cfg.Upstream.Balance, "balance", cfg.Upstream.Balance, "Send queries to the main endpoint and its replicas in turn")
+	fs.StringVar(&cfg.Upstream.Auth, "upstream-auth", cfg.Upstream.Auth, "Authentication of the SPARQL endpoints, basic or digest; the credentials are given by VINDU_UPSTREAM_USERNAME and VINDU_UPSTREAM_PASSWORD")
+	fs.BoolVar(&cfg.SPARQL.Enabled, "sparql-proxy", cfg.SPARQL.Enabled, "Pass read-only SPARQL queries at /sparql on to the endpoint")
+	fs.DurationVar(&cfg.SPARQL.Timeout, "sparql-timeout", cfg.SPARQL.Timeout, "Maximum run time of queries at /sparql")
+	fs.IntVar(&cfg.SPARQL.Limit, "sparql-limit", cfg.SPARQL.Limit, "Maximum number of results of queries at /sparql; 0 for no limit")
+	fs.BoolVar(&cfg.QueryPanel.Enabled, "query-panel", cfg.QueryPanel.Enabled, "Show the query describing the resource in the HTML view")
+	fs.StringVar(&cfg.QueryPanel.Endpoint, "query-panel-endpoint", cfg.QueryPanel.Endpoint, "SPARQL endpoint linked to from the query panel, as reachable from the browser; defaults to the first endpoint")
+	fs.StringVar(&cfg.Branding.Title, "site-title", cfg.Branding.Title, "Name of the site, shown in the header and titles of the HTML pages")
+	fs.StringVar(&cfg.Branding.Logo, "logo", cfg.Branding.Logo, "URL of a logo shown in the header of the HTML pages, e.g. /static/logo.png")
+	fs.StringVar(&cfg.Branding.Footer, "footer", cfg.Branding.Footer, "Text shown in the footer of the HTML pages, e.g. contact details")
+	fs.BoolVar(&cfg.QRCodes, "qr-codes", cfg.QRCodes, "Show QR codes of the resource URIs in the HTML view")
+	fs.IntVar(&cfg.Contents, "contents", cfg.Contents, "Number of values of a resource from which the HTML view has a table of contents; 0 disables it")
+	fs.IntVar(&cfg.VizLimit, "viz-limit", cfg.VizLimit, "Maximum number of links in the neighborhood diagrams; 0 disables them")
+	fs.IntVar(&cfg.TripleLimit, "triple-limit", cfg.TripleLimit, "Maximum number of triples of a description, beyond which it is truncated; 0 is no limit")
+	fs.IntVar(&cfg.MaxRows, "max-rows", cfg.MaxRows, "Maximum number of rows of the results of the endpoint (ResultSetMaxRows), from which descriptions are fetched in pages; 0 disables the paging")
+	fs.IntVar(&cfg.BatchSize, "batch-size", cfg.BatchSize, "Maximum number of resources described at once at /batch; 0 disables it")
+	fs.IntVar(&cfg.Tables.Threshold, "table-threshold", cfg.Tables.Threshold, "Number of values of a predicate from which they are shown as a table; 0 disables the tables")
+	fs.StringVar(&cfg.Breadcrumbs.Parent, "breadcrumbs", cfg.Breadcrumbs.Parent, "Predicate linking resources to their parent in the breadcrumbs; empty disables them")
+	fs.IntVar(&cfg.Browse.PageSize, "browse-page-size", cfg.Browse.PageSize, "Resources per page of the browse pages; 0 disables them")
+	fs.IntVar(&cfg.Incoming.Limit, "incoming", cfg.Incoming.Limit, "Maximum number of incoming links listed in the HTML view; 0 disables the listing")
+	fs.BoolVar(&cfg.Incoming.RDF, "incoming-rdf", cfg.Incoming.RDF, "Include the incoming links in the RDF formats")
+	fs.Var(graphsFlag{&cfg}, "graphs", "Graphs to expose under URL prefixes, e.g. /lsext=lsext,/staging=lsext@http://staging.deichman.no")
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+
+	// Remember the flags given on the command line, so they can be
+	// applied again after the file and environment are loaded.
+	set := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = f.Value.String() })
+
+	if configFile != "" {
+		if err := cfg.load(configFile); err != nil {
+			return cfg, err
+		}
+	}
+	cfg.loadEnv()
+	for name, value := range set {
+		if err := fs.Set(name, value); err != nil {
+			return cfg, err
+		}
+	}
+
+	if cfg.PrefixFile != "" {
+		prefixes, err := loadPrefixes(cfg.PrefixFile)
+		if err != nil {
+			return cfg, err
+		}
+		for name, ns := range cfg.Prefixes {
+			prefixes[name] = ns
+		}
+		cfg.Prefixes = prefixes
+	}
+	return cfg, nil
+}
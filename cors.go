@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// corsExposedHeaders are the response headers cross-origin scripts can read.
+const corsExposedHeaders = "Content-Language, Content-Location, ETag, Last-Modified, " + truncatedHeader + ", " + truncatedURIsHeader
+
+// corsAllowedHeaders are the request headers cross-origin scripts can set.
+const corsAllowedHeaders = "Accept, Accept-Language, If-Modified-Since, If-None-Match"
+
+// cors adds the CORS headers to the response to a cross-origin request
+// from an allowed origin. It answers preflight requests, returning true
+// when done.
+func (srv server) cors(w http.ResponseWriter, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || len(srv.corsOrigins) == 0 {
+		return false
+	}
+	h := w.Header()
+	h.Add("Vary", "Origin")
+	switch {
+	case srv.corsOrigins["*"]:
+		h.Set("Access-Control-Allow-Origin", "*")
+	case srv.corsOrigins[origin]:
+		h.Set("Access-Control-Allow-Origin", origin)
+	default:
+		return false
+	}
+	h.Set("Access-Control-Expose-Headers", corsExposedHeaders)
+	if r.Method != "OPTIONS" || r.Header.Get("Access-Control-Request-Method") == "" {
+		return false
+	}
+	// Batches are posted as JSON, and queries as SPARQL or forms.
+	if r.URL.Path == batchPath || r.URL.Path == sparqlPath {
+		h.Set("Access-Control-Allow-Methods", "GET, HEAD, POST, OPTIONS")
+		h.Set("Access-Control-Allow-Headers", corsAllowedHeaders+", Content-Type")
+	} else {
+		h.Set("Access-Control-Allow-Methods", allowedMethods)
+		h.Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+	}
+	if srv.corsMaxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.Itoa(int(srv.corsMaxAge.Seconds())))
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/csv"
+	"io"
+
+	"github.com/knakk/kbp/rdf"
+)
+
+// writeCSV writes the description as comma separated subject, predicate
+// and object columns, with prefixes applied.
+func (srv server) writeCSV(w io.Writer, res resolution, trs []rdf.Triple) error {
+	return srv.writeTable(csv.NewWriter(w), trs)
+}
+
+// writeTSV is like writeCSV, but with tab separated columns.
+func (srv server) writeTSV(w io.Writer, res resolution, trs []rdf.Triple) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = '\t'
+	return srv.writeTable(cw, trs)
+}
+
+func (srv server) writeTable(cw *csv.Writer, trs []rdf.Triple) error {
+	cw.Write([]string{"subject", "predicate", "object"})
+	for _, tr := range trs {
+		cw.Write([]string{srv.tableTerm(tr.Subject), srv.compactIRI(tr.Predicate.Name()), srv.tableTerm(tr.Object)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// tableTerm returns node as a table cell value. Literals are given by
+// their lexical value only.
+func (srv server) tableTerm(node rdf.Node) string {
+	switch n := node.(type) {
+	case rdf.NamedNode:
+		return srv.compactIRI(n.Name())
+	case rdf.Literal:
+		return n.ValueAsString()
+	}
+	return node.String()
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// trimPathPrefix returns path with prefix stripped, if prefix is a
+// leading segment of path.
+func trimPathPrefix(path, prefix string) (string, bool) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" || !strings.HasPrefix(path, prefix+"/") {
+		return path, false
+	}
+	return path[len(prefix):], true
+}
+
+// isThing reports whether the resource is a non-information resource,
+// which is redirected to the documents describing it.
+func (srv server) isThing(res resolution) bool {
+	if srv.things == nil {
+		return false
+	}
+	rel := strings.TrimPrefix(res.uri, res.base+"/")
+	return rel != res.uri && srv.things.MatchString(rel)
+}
+
+// seeOther redirects the request for a non-information resource at path
+// to the page describing it if the format is HTML, or else to the data
+// describing it.
+func (srv server) seeOther(w http.ResponseWriter, r *http.Request, f outputFormat, path string) {
+	prefix := srv.deref.Data
+	if f.mediaType == "text/html" {
+		prefix = srv.deref.Page
+	}
+	u := strings.TrimSuffix(prefix, "/") + path
+	if r.URL.RawQuery != "" {
+		u += "?" + r.URL.RawQuery
+	}
+	w.Header().Add("Vary", "Accept")
+	http.Redirect(w, r, srv.absURL(r, u), http.StatusSeeOther)
+}
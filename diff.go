@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/knakk/kbp/rdf"
+)
+
+// diffPath is where two resources are compared, given by their URIs in
+// the a and b parameters.
+const diffPath = "/diff"
+
+// diffDepth limits the nesting of blank nodes compared.
+const diffDepth = 10
+
+// resolveURI returns the resolution of the resource uri, served under
+// the first route whose base URI it is relative to. Like paths, uri is
+// refused unless it is a valid IRI.
+func (srv server) resolveURI(uri string) (resolution, error) {
+	for _, rt := range srv.routes {
+		if strings.HasPrefix(uri, rt.base+"/") {
+			return srv.resolver.resolve(rt.prefix + strings.TrimPrefix(uri, rt.base))
+		}
+	}
+	return resolution{}, fmt.Errorf("%s is not served here", uri)
+}
+
+// diffValues returns the values of the predicates of the resource uri in
+// trs, in Turtle syntax, keyed by predicate. Blank nodes are written out
+// with their descriptions, sorted, so that they compare equal when their
+// descriptions are.
+func (srv server) diffValues(uri string, trs []rdf.Triple) map[string][]string {
+	node := rdf.NewNamedNode(uri)
+	values := make(map[string][]string)
+	for _, tr := range trs {
+		if tr.Subject == node {
+			values[tr.Predicate.Name()] = append(values[tr.Predicate.Name()], srv.diffValue(tr.Object, trs, 0))
+		}
+	}
+	for _, vs := range values {
+		sort.Strings(vs)
+	}
+	return values
+}
+
+func (srv server) diffValue(o rdf.Node, trs []rdf.Triple, depth int) string {
+	b, ok := o.(rdf.BlankNode)
+	if !ok {
+		return turtleStyle{srv: srv}.term(o)
+	}
+	if depth >= diffDepth {
+		return "[]"
+	}
+	var parts []string
+	for _, tr := range trs {
+		if tr.Subject == b {
+			parts = append(parts, turtleStyle{srv: srv}.predicate(tr.Predicate)+" "+srv.diffValue(tr.Object, trs, depth+1))
+		}
+	}
+	sort.Strings(parts)
+	return "[ " + strings.Join(parts, " ; ") + " ]"
+}
+
+// serveDiff serves the comparison of the descriptions of the resources a
+// and b, side by side by predicate. Values only in a are marked as
+// removed, and values only in b as added. Without both parameters, a form
+// asking for them is served.
+func (srv server) serveDiff(w http.ResponseWriter, r *http.Request) {
+	f, _ := formatByName("html")
+	a, b := r.FormValue("a"), r.FormValue("b")
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "<form action=\"%s\"><input name=\"a\" value=\"%s\" placeholder=\"URI\" size=\"50\"> <input name=\"b\" value=\"%s\" placeholder=\"URI\" size=\"50\"> <input type=\"submit\" value=\"Compare\"></form>\n",
+		diffPath, html.EscapeString(a), html.EscapeString(b))
+	if a != "" && b != "" {
+		var descs [2][]rdf.Triple
+		for i, uri := range []string{a, b} {
+			res, err := srv.resolveURI(uri)
+			if err != nil {
+				srv.serveError(w, f, http.StatusBadRequest, err.Error(), nil)
+				return
+			}
+			// Fetched like the descriptions of resources, paged and
+			// coalesced, and truncated alike.
+			trs, err := srv.fetchDescription(res)
+			if err != nil {
+				srv.serveError(w, f, upstreamStatus(w, err, http.StatusInternalServerError), err.Error(), &res)
+				return
+			}
+			var cut bool
+			descs[i], cut = srv.truncate(trs)
+			srv.truncated = srv.truncated || cut
+		}
+		rt := srv.routes[len(srv.routes)-1]
+		srv.writeDiff(&body, htmlStyle{srv: srv, rt: rt}, a, b, descs[0], descs[1])
+	}
+	var truncated int
+	if srv.truncated {
+		truncated = srv.tripleLimit
+		w.Header().Set(truncatedHeader, strconv.Itoa(srv.tripleLimit))
+	}
+	w.Header().Set("Content-Type", f.contentType())
+	err := srv.writeHTMLPage(w, "diff", htmlPage{
+		Title:     "Compare resources",
+		Body:      template.HTML(body.String()),
+		Truncated: truncated,
+	})
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// writeDiff writes the table comparing the descriptions of a and b, with
+// a row per predicate in the order of the HTML view.
+func (srv server) writeDiff(w io.Writer, s htmlStyle, a, b string, as, bs []rdf.Triple) {
+	av, bv := srv.diffValues(a, as), srv.diffValues(b, bs)
+	// The predicates are sorted like the triples of a single resource.
+	var preds []rdf.Triple
+	for _, vs := range []map[string][]string{av, bv} {
+		for p := range vs {
+			preds = append(preds, rdf.Triple{Subject: rdf.NewNamedNode(a), Predicate: rdf.NewNamedNode(p)})
+		}
+	}
+	srv.sortTriples(preds)
+
+	var rows bytes.Buffer
+	var added, removed, changed int
+	seen := make(map[string]bool)
+	for _, tr := range preds {
+		p := tr.Predicate.Name()
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		inA, inB := valueSet(av[p]), valueSet(bv[p])
+		class := "same"
+		switch {
+		case len(av[p]) == 0:
+			class = "added"
+		case len(bv[p]) == 0:
+			class = "removed"
+		}
+		var cells [2]strings.Builder
+		for _, v := range av[p] {
+			if inB[v] {
+				fmt.Fprintf(&cells[0], "<div>%s</div>", highlight(v))
+				continue
+			}
+			fmt.Fprintf(&cells[0], "<div><del>%s</del></div>", highlight(v))
+			removed++
+			if class == "same" {
+				class = "changed"
+			}
+		}
+		for _, v := range bv[p] {
+			if inA[v] {
+				fmt.Fprintf(&cells[1], "<div>%s</div>", highlight(v))
+				continue
+			}
+			fmt.Fprintf(&cells[1], "<div><ins>%s</ins></div>", highlight(v))
+			added++
+			if class == "same" {
+				class = "changed"
+			}
+		}
+		if class == "changed" {
+			changed++
+		}
+		fmt.Fprintf(&rows, "<tr class=\"%s\"><th>%s</th><td>%s</td><td>%s</td></tr>\n", class, s.predicate(tr.Predicate), cells[0].String(), cells[1].String())
+	}
+
+	fmt.Fprintf(w, "<p>%d values added, %d removed, in %d predicates with changes.</p>\n", added, removed, changed)
+	io.WriteString(w, "<table class=\"diff\">\n<thead><tr><th></th>")
+	for _, uri := range []string{a, b} {
+		href, text := uri, uri
+		if rel, ok := s.link(uri); ok {
+			href, text = s.rt.prefix+"/"+rel, rel
+		}
+		fmt.Fprintf(w, "<th><a href=\"%s\">%s</a></th>", escapeHref(href), html.EscapeString(text))
+	}
+	io.WriteString(w, "</tr></thead>\n<tbody>\n")
+	rows.WriteTo(w)
+	io.WriteString(w, "</tbody>\n</table>\n")
+}
+
+// valueSet returns the set of the values vs.
+func valueSet(vs []string) map[string]bool {
+	set := make(map[string]bool, len(vs))
+	for _, v := range vs {
+		set[v] = true
+	}
+	return set
+}
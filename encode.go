@@ -0,0 +1,72 @@
+package main
+
+import (
+	"io"
+	"strings"
+
+	"github.com/knakk/kbp/rdf"
+)
+
+const (
+	xsdNS     = "http://www.w3.org/2001/XMLSchema#"
+	xsdString = xsdNS + "string"
+)
+
+var ntEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	`"`, `\"`,
+	"\n", `\n`,
+	"\r", `\r`,
+	"\t", `\t`,
+)
+
+// ntTerm returns the N-Triples representation of node.
+func ntTerm(node rdf.Node) string {
+	switch n := node.(type) {
+	case rdf.NamedNode:
+		return "<" + n.Name() + ">"
+	case rdf.Literal:
+		s := `"` + ntEscaper.Replace(n.ValueAsString()) + `"`
+		if n.Lang() != "" {
+			return s + "@" + n.Lang()
+		}
+		if dt := n.DataType().Name(); dt != "" && dt != xsdString {
+			return s + "^^<" + dt + ">"
+		}
+		return s
+	}
+	return node.String()
+}
+
+// ntriple returns the N-Triples representation of tr, without the
+// terminating newline.
+func ntriple(tr rdf.Triple) string {
+	return ntTerm(tr.Subject) + " " + ntTerm(tr.Predicate) + " " + ntTerm(tr.Object) + " ."
+}
+
+// writeNTriples writes trs to w in N-Triples format.
+func (srv server) writeNTriples(w io.Writer, res resolution, trs []rdf.Triple) error {
+	for _, tr := range trs {
+		if _, err := io.WriteString(w, ntriple(tr)+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeNQuads writes trs to w in N-Quads format, in the graph they were
+// fetched from. Triples fetched from a union of graphs are written in the
+// default graph.
+func (srv server) writeNQuads(w io.Writer, res resolution, trs []rdf.Triple) error {
+	graph := ""
+	if gs := defaultGraphs(res.graph); len(gs) == 1 {
+		graph = " <" + gs[0] + ">"
+	}
+	for _, tr := range trs {
+		s := ntriple(tr)
+		if _, err := io.WriteString(w, s[:len(s)-2]+graph+" .\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
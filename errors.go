@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// searchPlaceholder is replaced with the search terms in the search URL.
+const searchPlaceholder = "{{query}}"
+
+const defaultErrorTemplate = `<html><head><title>{{.Status}} {{.StatusText}}{{if .Site}} | {{.Site}}{{end}}</title></head><body>
+<h1>{{.StatusText}}</h1>
+<p>{{.Message}}</p>
+{{if .SearchURL}}<p><a href="{{.SearchURL}}">Search for {{.Query}}</a></p>
+{{end}}</body></html>
+`
+
+// errorPage is the data of error page templates.
+type errorPage struct {
+	Status     int
+	StatusText string
+	Message    string
+	// URI and Graph are the resource requested and the graph it was
+	// looked up in, if known.
+	URI   string
+	Graph string
+	// Query is the identifier of the resource, and SearchURL a link to
+	// search for it, if a search URL is configured.
+	Query     string
+	SearchURL string
+	// Site is the configured name of the site, if any.
+	Site string
+}
+
+// loadErrorTemplate returns the error page template in the file path, or
+// the built-in template if path is empty.
+func loadErrorTemplate(path string) (*template.Template, error) {
+	src := defaultErrorTemplate
+	if path != "" {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		src = string(b)
+	}
+	t, err := template.New("error").Parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("error template: %v", err)
+	}
+	return t, nil
+}
+
+// serveError replies with an error in the output format f: a page from the
+// error template for HTML, a JSON object for JSON formats, and a comment
+// for the line-based RDF formats. res is the resolved resource, if any.
+func (srv server) serveError(w http.ResponseWriter, f outputFormat, status int, msg string, res *resolution) {
+	page := errorPage{Status: status, StatusText: http.StatusText(status), Message: msg, Site: srv.branding.Title}
+	if res != nil {
+		page.URI, page.Graph = res.uri, res.graph
+		page.Query = strings.TrimPrefix(res.uri, res.base+"/")
+		if i := strings.LastIndex(page.Query, "/"); i >= 0 {
+			page.Query = page.Query[i+1:]
+		}
+		if srv.searchURL != "" {
+			page.SearchURL = strings.Replace(srv.searchURL, searchPlaceholder, url.QueryEscape(page.Query), -1)
+		}
+	}
+
+	h := w.Header()
+	h.Del("Content-Location")
+	h.Set("X-Content-Type-Options", "nosniff")
+	switch f.mediaType {
+	case "text/html":
+		h.Set("Content-Type", f.contentType())
+		w.WriteHeader(status)
+		if err := srv.errorTemplate.Execute(w, page); err != nil {
+			log.Println(err)
+		}
+	case "application/json", "application/ld+json", "application/geo+json":
+		h.Set("Content-Type", f.contentType())
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": status, "error": msg})
+	case "text/turtle", "application/trig", "application/n-triples", "application/n-quads", "text/plain":
+		h.Set("Content-Type", f.contentType())
+		w.WriteHeader(status)
+		fmt.Fprintf(w, "# %d %s\n# %s\n", status, page.StatusText, strings.Replace(msg, "\n", "\n# ", -1))
+	default:
+		http.Error(w, msg, status)
+	}
+}
+
+// notFoundMessage explains that the resource does not exist.
+func notFoundMessage(res resolution) string {
+	switch gs := defaultGraphs(res.graph); len(gs) {
+	case 0:
+		return fmt.Sprintf("The resource <%s> does not exist.", res.uri)
+	case 1:
+		return fmt.Sprintf("The resource <%s> does not exist in the graph <%s>.", res.uri, gs[0])
+	default:
+		return fmt.Sprintf("The resource <%s> does not exist in the graphs <%s>.", res.uri, strings.Join(gs, ">, <"))
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// The patterns of the triples exported, of the graph or of the resources
+// of a class.
+const (
+	exportPattern      = `?s ?p ?o`
+	exportClassPattern = `?s a <%s> ; ?p ?o`
+)
+
+const (
+	exportQuery = `CONSTRUCT { ?s ?p ?o } WHERE { %s }`
+	// exportPageQuery returns a page of the triples matching a pattern,
+	// scrolling through them like pageQuery.
+	exportPageQuery = `CONSTRUCT { ?s ?p ?o } WHERE { { SELECT ?s ?p ?o WHERE { %s } ORDER BY ?s ?p ?o LIMIT %d OFFSET %d } }`
+)
+
+// serveHDT dumps the default graph, or the resources of the class given
+// by the class parameter, as an HDT file. The triples are streamed from
+// the first endpoint to a temporary file, which is converted by the
+// external HDT tool (rdf2hdt from hdt-cpp). The triples are fetched in
+// pages of the maximum number of rows of the endpoint, so that the export
+// is not cut off at ResultSetMaxRows.
+//
+// Range requests are supported, but only resume downloads across requests
+// when the exports are kept in an export directory.
+func (h *handler) serveHDT(w http.ResponseWriter, r *http.Request) {
+	srv := h.srv.Load().(server)
+	if len(srv.endpoints) == 0 {
+		http.Error(w, "exports need a SPARQL endpoint", http.StatusNotFound)
+		return
+	}
+	rt := srv.routes[len(srv.routes)-1]
+	pattern, name := exportPattern, strings.Join(defaultGraphs(rt.graph), "+")
+	if name == "" {
+		name = "all"
+	}
+	class := r.FormValue("class")
+	if class != "" {
+		iri := expandIRI(class, srv.prefixes)
+		if !validIRI(iri) {
+			http.Error(w, fmt.Sprintf("invalid class: %q", class), http.StatusBadRequest)
+			return
+		}
+		pattern, name = fmt.Sprintf(exportClassPattern, iri), name+"-"+srv.compactIRI(iri)
+		class = iri
+	}
+
+	// The name is built from IRIs, so only the characters safe in file
+	// names are kept. The file in the export directory also gets a hash
+	// of the graph and class, so that exports whose names end up the same
+	// don't collide.
+	filename := exportFilename(name)
+
+	// Exports are kept in the export directory, if any, so that
+	// interrupted downloads can be resumed. refresh=true regenerates them.
+	dir, keep := srv.exportDir, true
+	if dir == "" {
+		tmp, err := ioutil.TempDir("", "vindu-hdt")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer os.RemoveAll(tmp)
+		dir, keep = tmp, false
+	}
+	sum := sha1.Sum([]byte(rt.graph + "\n" + class))
+	hdt := filepath.Join(dir, fmt.Sprintf("%s-%x.hdt", strings.TrimSuffix(filename, ".hdt"), sum[:8]))
+	if filepath.Dir(hdt) != filepath.Clean(dir) {
+		http.Error(w, fmt.Sprintf("invalid export name: %q", filename), http.StatusBadRequest)
+		return
+	}
+	if _, err := os.Stat(hdt); err != nil || !keep || r.FormValue("refresh") == "true" {
+		if err := srv.generateHDT(r, rt, pattern, hdt); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	f, err := os.Open(hdt)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/vnd.hdt")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	// Served with support for Range requests, so that interrupted
+	// downloads can be resumed.
+	http.ServeContent(w, r, "", fi.ModTime(), f)
+}
+
+// rgxpExportUnsafe matches the characters not kept in export file names.
+var rgxpExportUnsafe = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// exportFilename returns the file name of the export of the given name,
+// with the characters other than letters, digits, '_', '.' and '-'
+// replaced.
+func exportFilename(name string) string {
+	return strings.Trim(rgxpExportUnsafe.ReplaceAllString(name, "_"), "._") + ".hdt"
+}
+
+// generateHDT writes the triples matching pattern to the file path in HDT
+// format. The file is replaced atomically.
+func (srv server) generateHDT(r *http.Request, rt route, pattern, path string) error {
+	nt, err := ioutil.TempFile(filepath.Dir(path), "vindu-export")
+	if err != nil {
+		return err
+	}
+	nt.Close()
+	defer os.Remove(nt.Name())
+	if err := dumpNTriples(r.Context(), srv.endpoints[0], rt.graph, pattern, srv.maxRows, nt.Name()); err != nil {
+		return err
+	}
+	tmp := nt.Name() + ".hdt"
+	defer os.Remove(tmp)
+	if out, err := exec.CommandContext(r.Context(), srv.hdtTool, "-B", rt.base+"/", nt.Name(), tmp).CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %v\n%s", srv.hdtTool, err, out)
+	}
+	return os.Rename(tmp, path)
+}
+
+// dumpNTriples streams the triples matching pattern to the file path, in
+// N-Triples format. They are fetched in pages of pageSize triples, until
+// a page comes back short, or in a single query if pageSize is 0.
+func dumpNTriples(ctx context.Context, endpoint, graph, pattern string, pageSize int, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	for offset := 0; ; offset += pageSize {
+		q := fmt.Sprintf(exportQuery, pattern)
+		if pageSize > 0 {
+			q = fmt.Sprintf(exportPageQuery, pattern, pageSize, offset)
+		}
+		n, err := dumpPage(ctx, endpoint, graph, q, f)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		if pageSize == 0 || n < pageSize {
+			return f.Close()
+		}
+	}
+}
+
+// dumpPage copies the result of the graph query q to w, returning the
+// number of triples, one per line in N-Triples.
+func dumpPage(ctx context.Context, endpoint, graph, q string, w io.Writer) (int, error) {
+	resp, err := query(ctx, endpoint, graph, q, "text/plain")
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	lc := &lineCounter{w: w}
+	_, err = io.Copy(lc, resp.Body)
+	return lc.n, err
+}
+
+// lineCounter counts the lines written through it.
+type lineCounter struct {
+	w io.Writer
+	n int
+}
+
+func (lc *lineCounter) Write(p []byte) (int, error) {
+	n, err := lc.w.Write(p)
+	lc.n += bytes.Count(p[:n], []byte("\n"))
+	return n, err
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// feedPath is where the feed of recently modified resources is served.
+const feedPath = "/feed"
+
+const feedQuery = `SELECT ?s ?modified WHERE { ?s <%s> ?modified FILTER isIRI(?s) } ORDER BY DESC(?modified) LIMIT %d`
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Link    atomLink    `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	ID      string   `xml:"id"`
+	Title   string   `xml:"title"`
+	Updated string   `xml:"updated"`
+	Link    atomLink `xml:"link"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+// serveFeed serves an Atom feed of the most recently modified resources
+// in the default graph, ordered by the feed predicate.
+func (srv server) serveFeed(w http.ResponseWriter, r *http.Request) {
+	rt := srv.routes[len(srv.routes)-1]
+	rows, err := selectRows(srv.reqContext(), srv.endpoints[0], rt.graph, fmt.Sprintf(feedQuery, srv.feed.Predicate, srv.feed.Size))
+	if err != nil {
+		http.Error(w, err.Error(), upstreamStatus(w, err, http.StatusInternalServerError))
+		return
+	}
+
+	feed := atomFeed{
+		ID:    rt.base + feedPath,
+		Title: srv.feed.Title,
+		Link:  atomLink{Rel: "self", Href: srv.absURL(r, feedPath)},
+	}
+	for _, row := range rows {
+		e := atomEntry{ID: row["s"], Title: row["s"], Updated: atomTime(row["modified"]), Link: atomLink{Href: row["s"]}}
+		if rel := strings.TrimPrefix(row["s"], rt.base+"/"); rel != row["s"] {
+			e.Title = rel
+			e.Link.Href = srv.absURL(r, rt.prefix+"/"+rel)
+		}
+		feed.Entries = append(feed.Entries, e)
+	}
+	if len(feed.Entries) > 0 {
+		feed.Updated = feed.Entries[0].Updated
+	} else {
+		feed.Updated = time.Now().UTC().Format(time.RFC3339)
+	}
+
+	w.Header().Set("Content-Type", "application/atom+xml")
+	io.WriteString(w, xml.Header)
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(feed); err != nil {
+		log.Println(err)
+	}
+}
+
+// atomTime returns the xsd:dateTime v in the RFC 3339 form required by
+// Atom. Values which can't be parsed are returned unchanged.
+func atomTime(v string) string {
+	t, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		return v
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"github.com/knakk/kbp/rdf"
+)
+
+// writeJSON writes the description as a plain JSON object, for clients
+// which don't want RDF. The keys are the abbreviated predicates, with
+// "id" and "type" for the URI and classes of the resource. Properties
+// with several values have arrays of values. Literals are given as
+// strings, numbers or booleans, without language or datatype; IRIs as
+// strings; lists as arrays; and other blank nodes as nested objects.
+func (srv server) writeJSON(w io.Writer, res resolution, trs []rdf.Triple) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(srv.flatObject(rdf.NewNamedNode(res.uri), trs, make(map[rdf.Node]bool)))
+}
+
+// flatObject returns the flattened description of node. Nodes in seen are
+// not nested again, to guard against cycles of blank nodes.
+func (srv server) flatObject(node rdf.Node, trs []rdf.Triple, seen map[rdf.Node]bool) map[string]interface{} {
+	seen[node] = true
+	obj := make(map[string]interface{})
+	if n, ok := node.(rdf.NamedNode); ok {
+		obj["id"] = n.Name()
+	}
+	values := make(map[string][]interface{})
+	for _, tr := range trs {
+		if tr.Subject != node {
+			continue
+		}
+		key := srv.compactIRI(tr.Predicate.Name())
+		if tr.Predicate.Name() == rdfType {
+			key = "type"
+		}
+		var v interface{}
+		switch o := tr.Object.(type) {
+		case rdf.NamedNode:
+			v = o.Name()
+			if key == "type" {
+				v = srv.compactIRI(o.Name())
+			}
+		case rdf.BlankNode:
+			if seen[o] {
+				continue
+			}
+			if items, ok := rdfList(o, trs); ok {
+				list := make([]interface{}, len(items))
+				for i, item := range items {
+					if l, ok := item.(rdf.Literal); ok {
+						list[i] = flatLiteral(l)
+					} else {
+						list[i] = item.(rdf.NamedNode).Name()
+					}
+				}
+				v = list
+				break
+			}
+			v = srv.flatObject(o, trs, seen)
+		case rdf.Literal:
+			v = flatLiteral(o)
+		}
+		values[key] = append(values[key], v)
+	}
+	for key, vs := range values {
+		if len(vs) == 1 {
+			obj[key] = vs[0]
+		} else {
+			obj[key] = vs
+		}
+	}
+	return obj
+}
+
+// flatLiteral returns the value of l, as a number or boolean for the
+// numeric and boolean datatypes.
+func flatLiteral(l rdf.Literal) interface{} {
+	v := l.ValueAsString()
+	switch l.DataType().Name() {
+	case xsdNS + "integer", xsdNS + "int", xsdNS + "long", xsdNS + "decimal", xsdNS + "double", xsdNS + "float":
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	case xsdNS + "boolean":
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	return v
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/golang/gddo/httputil"
+	"github.com/knakk/kbp/rdf"
+)
+
+// outputFormat is a format resources can be served in.
+type outputFormat struct {
+	mediaType string
+	// proxy is set for formats the SPARQL endpoint can produce itself.
+	// Those without a write function are passed through unchanged when
+	// there is a single endpoint.
+	proxy bool
+	// extension selects the format when suffixed to the resource path,
+	// for clients which can't set the Accept header.
+	extension string
+	// name selects the format in the format query parameter.
+	name string
+	// localized is set for formats meant for people, where literals are
+	// filtered by the Accept-Language header.
+	localized bool
+	// write renders the description of a resource. It is nil for
+	// formats which are only available when proxied.
+	write func(srv server, w io.Writer, res resolution, trs []rdf.Triple) error
+}
+
+// contentType returns the Content-Type header value of the format.
+func (f outputFormat) contentType() string {
+	if strings.HasPrefix(f.mediaType, "text/") {
+		return f.mediaType + "; charset=utf-8"
+	}
+	return f.mediaType
+}
+
+// outputFormats are the supported formats. The first is the default,
+// unless another is configured.
+var outputFormats []outputFormat
+
+func init() {
+	outputFormats = []outputFormat{
+		{mediaType: "text/plain", proxy: true, write: server.writeNTriples},
+		{mediaType: "text/turtle", name: "turtle", extension: ".ttl", write: server.writeTurtle},
+		{mediaType: "application/trig", name: "trig", extension: ".trig", write: server.writeTriG},
+		{mediaType: "application/rdf+xml", name: "xml", extension: ".rdf", write: server.writeRDFXML},
+		{mediaType: "text/html", name: "html", extension: ".html", localized: true, write: server.writeHTML},
+		{mediaType: "application/ld+json", name: "jsonld", extension: ".jsonld", write: server.writeJSONLD},
+		{mediaType: "application/n-triples", name: "ntriples", extension: ".nt", write: server.writeNTriples},
+		{mediaType: "application/n-quads", name: "nquads", extension: ".nq", write: server.writeNQuads},
+		{mediaType: "application/json", name: "json", extension: ".json", localized: true, write: server.writeJSON},
+		{mediaType: "application/geo+json", name: "geojson", extension: ".geojson", write: server.writeGeoJSON},
+		{mediaType: "application/marcxml+xml", name: "marcxml", write: server.writeMARCXML},
+		{mediaType: "text/csv", name: "csv", extension: ".csv", write: server.writeCSV},
+		{mediaType: "text/tab-separated-values", name: "tsv", extension: ".tsv", write: server.writeTSV},
+	}
+}
+
+// negotiateFormat returns the output format best matching the Accept
+// header of r. The default format is used if there is no Accept header,
+// and wins ties between equally acceptable formats, e.g. for */*.
+func (srv server) negotiateFormat(r *http.Request) outputFormat {
+	offers := []string{srv.defaultFormat.mediaType}
+	for _, f := range outputFormats {
+		if (f.write != nil || len(srv.endpoints) == 1) && f.mediaType != srv.defaultFormat.mediaType {
+			offers = append(offers, f.mediaType)
+		}
+	}
+	mediaType := httputil.NegotiateContentType(r, offers, srv.defaultFormat.mediaType)
+	for _, f := range outputFormats {
+		if f.mediaType == mediaType {
+			return f
+		}
+	}
+	return srv.defaultFormat
+}
+
+// lookupFormat returns the output format with the given name or media
+// type.
+func lookupFormat(s string) (outputFormat, bool) {
+	for _, f := range outputFormats {
+		if f.mediaType == s {
+			return f, true
+		}
+	}
+	return formatByName(s)
+}
+
+// formatByExtension returns the output format selected by the extension
+// of p, and p with the extension stripped. ok is false if p has no known
+// extension.
+func formatByExtension(p string) (f outputFormat, stripped string, ok bool) {
+	ext := path.Ext(p)
+	if ext == "" {
+		return f, p, false
+	}
+	for _, f := range outputFormats {
+		if f.extension == ext {
+			return f, strings.TrimSuffix(p, ext), true
+		}
+	}
+	return f, p, false
+}
+
+// formatByName returns the output format with the given name.
+func formatByName(name string) (outputFormat, bool) {
+	for _, f := range outputFormats {
+		if f.name == name {
+			return f, true
+		}
+	}
+	return outputFormat{}, false
+}
+
+// downloadFormats are the formats linked to from the HTML view, by name,
+// with their titles.
+var downloadFormats = []struct {
+	name, title string
+}{
+	{"turtle", "Turtle"},
+	{"jsonld", "JSON-LD"},
+	{"xml", "RDF/XML"},
+	{"ntriples", "N-Triples"},
+}
+
+// formatLink links to the description of a resource in another format.
+type formatLink struct {
+	Title     string
+	MediaType string
+	Href      string
+}
+
+// formatLinks returns links to the description of the resource in the
+// download formats, using their extensions.
+func (srv server) formatLinks(res resolution) []formatLink {
+	rel := strings.TrimPrefix(res.uri, res.base+"/")
+	if rel == res.uri {
+		return nil
+	}
+	var links []formatLink
+	for _, d := range downloadFormats {
+		f, ok := formatByName(d.name)
+		if !ok || f.write == nil && len(srv.endpoints) > 1 {
+			continue
+		}
+		href := (&url.URL{Path: res.prefix + "/" + rel + f.extension}).EscapedPath()
+		links = append(links, formatLink{Title: d.title, MediaType: f.mediaType, Href: href})
+	}
+	return links
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// parseNetworks parses a list of IP addresses and CIDR networks.
+func parseNetworks(addrs []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, addr := range addrs {
+		if !strings.Contains(addr, "/") {
+			if ip := net.ParseIP(addr); ip != nil && ip.To4() != nil {
+				addr += "/32"
+			} else {
+				addr += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(addr)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy: %v", err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// trustedProxy reports whether r comes directly from a trusted proxy,
+// whose X-Forwarded-* headers can be believed.
+func (srv server) trustedProxy(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	for _, n := range srv.trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// absURL returns the absolute URL of path as seen by the client. Behind
+// a trusted proxy, the scheme and host are taken from the
+// X-Forwarded-Proto and X-Forwarded-Host headers.
+func (srv server) absURL(r *http.Request, path string) string {
+	scheme, host := "http", r.Host
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if srv.trustedProxy(r) {
+		if p := firstForwarded(r, "X-Forwarded-Proto"); p == "http" || p == "https" {
+			scheme = p
+		}
+		if h := firstForwarded(r, "X-Forwarded-Host"); h != "" {
+			host = h
+		}
+	}
+	return scheme + "://" + host + path
+}
+
+// firstForwarded returns the first value of a X-Forwarded-* header, set
+// by the proxy closest to the client.
+func firstForwarded(r *http.Request, name string) string {
+	v := r.Header.Get(name)
+	if i := strings.Index(v, ","); i >= 0 {
+		v = v[:i]
+	}
+	return strings.TrimSpace(v)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"github.com/knakk/kbp/rdf"
+)
+
+// geoJSONFeature is a GeoJSON Feature, see RFC 7946.
+type geoJSONFeature struct {
+	Type       string                 `json:"type"`
+	ID         string                 `json:"id"`
+	Geometry   *geoJSONPoint          `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type geoJSONPoint struct {
+	Type        string    `json:"type"`
+	Coordinates []float64 `json:"coordinates"`
+}
+
+// writeGeoJSON writes the resource as a GeoJSON Feature, located by its
+// latitude and longitude. The geometry is null if the resource has no
+// valid coordinates. Literal properties are included, keyed by their
+// abbreviated predicates.
+func (srv server) writeGeoJSON(w io.Writer, res resolution, trs []rdf.Triple) error {
+	node := rdf.NewNamedNode(res.uri)
+	f := geoJSONFeature{Type: "Feature", ID: res.uri, Properties: make(map[string]interface{})}
+	var lat, long string
+	for _, tr := range trs {
+		if tr.Subject != node {
+			continue
+		}
+		l, ok := tr.Object.(rdf.Literal)
+		if !ok {
+			continue
+		}
+		switch tr.Predicate.Name() {
+		case srv.geo.Latitude:
+			lat = l.ValueAsString()
+		case srv.geo.Longitude:
+			long = l.ValueAsString()
+		default:
+			key := srv.compactIRI(tr.Predicate.Name())
+			switch v := f.Properties[key].(type) {
+			case nil:
+				f.Properties[key] = l.ValueAsString()
+			case string:
+				f.Properties[key] = []string{v, l.ValueAsString()}
+			case []string:
+				f.Properties[key] = append(v, l.ValueAsString())
+			}
+		}
+	}
+	y, err1 := strconv.ParseFloat(lat, 64)
+	x, err2 := strconv.ParseFloat(long, 64)
+	if err1 == nil && err2 == nil {
+		f.Geometry = &geoJSONPoint{Type: "Point", Coordinates: []float64{x, y}}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(f)
+}
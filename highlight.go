@@ -0,0 +1,117 @@
+package main
+
+import (
+	"html"
+	"strings"
+)
+
+// Token classes of the Turtle highlighter, used as CSS class names.
+const (
+	tokKeyword  = "kw"
+	tokIRI      = "iri"
+	tokPName    = "pn"
+	tokBlank    = "bn"
+	tokLiteral  = "lit"
+	tokLang     = "lang"
+	tokDatatype = "dt"
+)
+
+// highlightCSS colors the tokens of the highlighter, and the labels of
+// linked resources. It is part of the default stylesheet.
+const highlightCSS = `.kw{color:#a626a4}.iri{color:#4078f2}.pn{color:#0184bc}.bn{color:#986801}` +
+	`.lit{color:#50a14f}.lang,.dt{color:#c18401}.label{color:#a0a1a7;font-style:italic}` + "\n"
+
+// highlight returns the Turtle in s as HTML, with the tokens wrapped in
+// spans classed by their kind. Anything not recognized is passed through,
+// escaped.
+func highlight(s string) string {
+	var b strings.Builder
+	var prev string
+	for i := 0; i < len(s); {
+		j, class := i+1, ""
+		switch c := s[i]; {
+		case c == '<':
+			j = scanPast(s, i+1, '>')
+			class = tokIRI
+		case c == '"':
+			j = scanString(s, i+1)
+			class = tokLiteral
+		case c == '@':
+			j = scanName(s, i+1)
+			class = tokKeyword
+			if prev == tokLiteral {
+				class = tokLang
+			}
+		case c == '^' && strings.HasPrefix(s[i:], "^^"):
+			j = i + 2
+			class = tokDatatype
+		case isNameByte(c):
+			if j = scanName(s, i); j == i {
+				j = i + 1
+				break
+			}
+			switch word := s[i:j]; {
+			case word == "a", strings.EqualFold(word, "prefix"), strings.EqualFold(word, "base"):
+				class = tokKeyword
+			case word == "true", word == "false", c >= '0' && c <= '9', c == '+', c == '-':
+				class = tokLiteral
+			case strings.HasPrefix(word, "_:"):
+				class = tokBlank
+			case strings.Contains(word, ":"):
+				class = tokPName
+			}
+		}
+		if prev == tokDatatype && (class == tokIRI || class == tokPName) {
+			class = tokDatatype
+		}
+		if class == "" {
+			b.WriteString(html.EscapeString(s[i:j]))
+		} else {
+			b.WriteString(`<span class="` + class + `">` + html.EscapeString(s[i:j]) + `</span>`)
+		}
+		prev = class
+		i = j
+	}
+	return b.String()
+}
+
+// scanPast returns the index after the first c in s at or after i, or
+// len(s) if there is none.
+func scanPast(s string, i int, c byte) int {
+	if n := strings.IndexByte(s[i:], c); n >= 0 {
+		return i + n + 1
+	}
+	return len(s)
+}
+
+// scanString returns the index after the closing quote of the string
+// literal starting at i, skipping escaped characters.
+func scanString(s string, i int) int {
+	for ; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return len(s)
+}
+
+// scanName returns the index after the name starting at start.
+func scanName(s string, start int) int {
+	i := start
+	for i < len(s) && isNameByte(s[i]) {
+		i++
+	}
+	// A trailing dot ends the statement.
+	for i > start && s[i-1] == '.' {
+		i--
+	}
+	return i
+}
+
+func isNameByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '_' || c == '-' || c == '.' || c == ':' || c >= 0x80
+}
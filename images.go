@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+
+	"github.com/knakk/kbp/rdf"
+)
+
+// imageURL returns the URL of the image o, if it is an object of one of
+// the image predicates and an absolute http or https URL. The URL may be
+// given as an IRI or a literal.
+func (s htmlStyle) imageURL(p rdf.NamedNode, o rdf.Node) (string, bool) {
+	if !s.srv.images[p.Name()] {
+		return "", false
+	}
+	var v string
+	switch obj := o.(type) {
+	case rdf.NamedNode:
+		v = obj.Name()
+	case rdf.Literal:
+		v = obj.ValueAsString()
+	default:
+		return "", false
+	}
+	u, err := url.Parse(v)
+	if err != nil || u.Host == "" || u.Scheme != "http" && u.Scheme != "https" {
+		return "", false
+	}
+	return v, true
+}
+
+// image renders the image at src as a lazily loaded thumbnail, linking to
+// the image, in place of the object o of the RDFa attributes prop.
+func (s htmlStyle) image(prop string, o rdf.Node, src string) string {
+	attr := "resource"
+	if _, ok := o.(rdf.Literal); ok {
+		attr = "content"
+	}
+	src = html.EscapeString(src)
+	return fmt.Sprintf(`<a %s %s="%s" href="%[3]s"><img class="thumb" src="%[3]s" alt="" loading="lazy"></a>`, prop, attr, src)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"io"
+
+	"github.com/knakk/kbp/rdf"
+)
+
+const incomingQuery = `SELECT ?s ?p WHERE { ?s ?p <%s> FILTER (isIRI(?s) && ?s != <%[1]s>) } ORDER BY ?s ?p LIMIT %d`
+
+// incoming returns the triples of the resources linking to the resource,
+// up to the configured limit.
+func (srv server) incoming(res resolution) ([]rdf.Triple, error) {
+	rows, err := selectRows(srv.reqContext(), srv.endpoints[0], res.graph, fmt.Sprintf(incomingQuery, res.uri, srv.incomingLimit))
+	if err != nil {
+		return nil, err
+	}
+	node := rdf.NewNamedNode(res.uri)
+	trs := make([]rdf.Triple, 0, len(rows))
+	for _, row := range rows {
+		trs = append(trs, rdf.Triple{Subject: rdf.NewNamedNode(row["s"]), Predicate: rdf.NewNamedNode(row["p"]), Object: node})
+	}
+	return trs, nil
+}
+
+// writeIncoming writes the "What links here" section, listing the other
+// resources with node as object. Nothing is written if there are none.
+func writeIncoming(w io.Writer, s htmlStyle, node rdf.NamedNode, trs []rdf.Triple) {
+	first := true
+	for _, tr := range trs {
+		subj, ok := tr.Subject.(rdf.NamedNode)
+		if !ok || tr.Object != node || subj == node {
+			continue
+		}
+		if first {
+			fmt.Fprintf(w, "<section about=\"%s\">\n<h2>What links here</h2>\n<ul>\n", html.EscapeString(node.Name()))
+			first = false
+		}
+		href, text := subj.Name(), subj.Name()
+		if rel, ok := s.link(subj.Name()); ok {
+			href, text = s.rt.prefix+"/"+rel, rel
+		}
+		fmt.Fprintf(w, `<li><a rev="%s" resource="%s" href="%s">%s</a>`,
+			html.EscapeString(tr.Predicate.Name()), html.EscapeString(subj.Name()), escapeHref(href), html.EscapeString(text))
+		if label, ok := s.labels[subj.Name()]; ok {
+			fmt.Fprintf(w, ` <span class="label">%s</span>`, html.EscapeString(label))
+		}
+		fmt.Fprintf(w, " %s</li>\n", s.predicate(tr.Predicate))
+	}
+	if !first {
+		io.WriteString(w, "</ul>\n</section>\n")
+	}
+}
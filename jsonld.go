@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/knakk/kbp/rdf"
+)
+
+const rdfType = "http://www.w3.org/1999/02/22-rdf-syntax-ns#type"
+
+// jsonldObject is a JSON-LD node or value object.
+type jsonldObject map[string]interface{}
+
+// jsonldContext returns the JSON-LD context derived from the prefix table.
+func (srv server) jsonldContext() map[string]string {
+	ctx := make(map[string]string, len(srv.prefixes))
+	for name, ns := range srv.prefixes {
+		ctx[name] = ns
+	}
+	return ctx
+}
+
+// writeJSONLD writes the description as JSON-LD, framed with the resource
+// as the top-level node and blank nodes embedded where they are referenced.
+// Any other subjects are included in a @graph along with the resource.
+func (srv server) writeJSONLD(w io.Writer, res resolution, trs []rdf.Triple) error {
+	bySubject := make(map[rdf.Node][]rdf.Triple)
+	var subjects []rdf.Node
+	for _, tr := range trs {
+		if _, ok := bySubject[tr.Subject]; !ok {
+			subjects = append(subjects, tr.Subject)
+		}
+		bySubject[tr.Subject] = append(bySubject[tr.Subject], tr)
+	}
+
+	embedded := make(map[rdf.Node]bool)
+	main := rdf.NewNamedNode(res.uri)
+	nodes := []jsonldObject{srv.jsonldNode(main, bySubject, embedded)}
+	for _, subj := range subjects {
+		if subj != main && !embedded[subj] {
+			nodes = append(nodes, srv.jsonldNode(subj, bySubject, embedded))
+		}
+	}
+
+	var doc jsonldObject
+	if len(nodes) == 1 {
+		doc = nodes[0]
+	} else {
+		doc = jsonldObject{"@graph": nodes}
+	}
+	doc["@context"] = srv.jsonldContext()
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(doc)
+}
+
+// jsonldNode returns the JSON-LD node object describing node, embedding
+// the blank nodes it references. Embedded nodes are recorded in embedded.
+func (srv server) jsonldNode(node rdf.Node, bySubject map[rdf.Node][]rdf.Triple, embedded map[rdf.Node]bool) jsonldObject {
+	embedded[node] = true
+	obj := jsonldObject{"@id": srv.jsonldID(node)}
+	var keys []string
+	values := make(map[string][]interface{})
+	for _, tr := range bySubject[node] {
+		key := srv.compactIRI(tr.Predicate.Name())
+		var v interface{}
+		if tr.Predicate.Name() == rdfType {
+			key = "@type"
+			v = srv.jsonldID(tr.Object)
+		} else {
+			v = srv.jsonldValue(tr.Object, bySubject, embedded)
+		}
+		if _, ok := values[key]; !ok {
+			keys = append(keys, key)
+		}
+		values[key] = append(values[key], v)
+	}
+	for _, key := range keys {
+		if len(values[key]) == 1 {
+			obj[key] = values[key][0]
+		} else {
+			obj[key] = values[key]
+		}
+	}
+	return obj
+}
+
+// jsonldValue returns the JSON-LD representation of an object node.
+func (srv server) jsonldValue(node rdf.Node, bySubject map[rdf.Node][]rdf.Triple, embedded map[rdf.Node]bool) interface{} {
+	switch n := node.(type) {
+	case rdf.BlankNode:
+		if _, ok := bySubject[n]; ok && !embedded[n] {
+			return srv.jsonldNode(n, bySubject, embedded)
+		}
+	case rdf.Literal:
+		if n.Lang() != "" {
+			return jsonldObject{"@value": n.ValueAsString(), "@language": n.Lang()}
+		}
+		if dt := n.DataType().Name(); dt != "" && dt != xsdString {
+			return jsonldObject{"@value": n.ValueAsString(), "@type": srv.compactIRI(dt)}
+		}
+		return n.ValueAsString()
+	}
+	return jsonldObject{"@id": srv.jsonldID(node)}
+}
+
+// jsonldID returns the JSON-LD identifier of a named or blank node.
+func (srv server) jsonldID(node rdf.Node) string {
+	if n, ok := node.(rdf.NamedNode); ok {
+		return srv.compactIRI(n.Name())
+	}
+	return node.String()
+}
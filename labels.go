@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/knakk/kbp/rdf"
+)
+
+// labelBatch is the number of resources whose labels are looked up per
+// query.
+const labelBatch = 100
+
+const labelQuery = `SELECT ?s ?p ?label WHERE { VALUES ?s { %s } ?s ?p ?label FILTER (?p IN (%s) && isLiteral(?label)) }`
+
+// linkLabels returns the labels of the resources linked to or from the
+// HTML view of the description, and of the resources more, keyed by IRI.
+func (srv server) linkLabels(s htmlStyle, res resolution, trs []rdf.Triple, more ...string) map[string]string {
+	if len(srv.labels) == 0 {
+		return nil
+	}
+	var iris []string
+	seen := map[string]bool{res.uri: true}
+	for _, tr := range trs {
+		// Links go from the resource to its objects, and to the subjects
+		// of the incoming links.
+		o, ok := tr.Object.(rdf.NamedNode)
+		if ok && o.Name() == res.uri {
+			o, ok = tr.Subject.(rdf.NamedNode)
+		}
+		if !ok || seen[o.Name()] {
+			continue
+		}
+		seen[o.Name()] = true
+		if _, ok := s.link(o.Name()); ok {
+			iris = append(iris, o.Name())
+		}
+	}
+	for _, iri := range more {
+		if !seen[iri] {
+			seen[iri] = true
+			iris = append(iris, iri)
+		}
+	}
+	return srv.lookupLabels(res.graph, iris)
+}
+
+// lookupLabels returns the labels of the resources iris in graph, keyed
+// by IRI. The label predicates are tried in the configured order. Failing
+// lookups are logged, and the labels left out.
+func (srv server) lookupLabels(graph string, iris []string) map[string]string {
+	if len(srv.labels) == 0 || len(iris) == 0 {
+		return nil
+	}
+	rank := make(map[string]int, len(srv.labels))
+	for i, p := range srv.labels {
+		rank[p] = i
+	}
+	labels := make(map[string]string)
+	best := make(map[string]int)
+	for len(iris) > 0 {
+		n := len(iris)
+		if n > labelBatch {
+			n = labelBatch
+		}
+		// IRIs from the data which can't be written in a query are
+		// left out.
+		var refs []string
+		for _, iri := range iris[:n] {
+			if validIRI(iri) {
+				refs = append(refs, "<"+iri+">")
+			}
+		}
+		iris = iris[n:]
+		if len(refs) == 0 {
+			continue
+		}
+		q := fmt.Sprintf(labelQuery, strings.Join(refs, " "), srv.labelPredicates())
+		rows, err := selectRows(srv.reqContext(), srv.endpoints[0], graph, q)
+		if err != nil {
+			log.Printf("looking up labels: %v", err)
+			continue
+		}
+		for _, row := range rows {
+			if r, ok := best[row["s"]]; ok && r <= rank[row["p"]] {
+				continue
+			}
+			labels[row["s"]], best[row["s"]] = row["label"], rank[row["p"]]
+		}
+	}
+	return labels
+}
+
+// labelPredicates returns the label predicates as a comma separated list
+// of IRI references, for use in queries.
+func (srv server) labelPredicates() string {
+	preds := make([]string, len(srv.labels))
+	for i, p := range srv.labels {
+		preds[i] = "<" + p + ">"
+	}
+	return strings.Join(preds, ", ")
+}
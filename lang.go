@@ -0,0 +1,135 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/golang/gddo/httputil/header"
+	"github.com/knakk/kbp/rdf"
+)
+
+// acceptLanguages returns the language ranges of the Accept-Language
+// header of r, most preferred first. Unacceptable ranges (q=0) are left
+// out.
+func acceptLanguages(r *http.Request) []string {
+	specs := header.ParseAccept(r.Header, "Accept-Language")
+	sort.SliceStable(specs, func(i, j int) bool { return specs[i].Q > specs[j].Q })
+	var ranges []string
+	for _, spec := range specs {
+		if spec.Q > 0 {
+			ranges = append(ranges, strings.ToLower(spec.Value))
+		}
+	}
+	return ranges
+}
+
+// langRank returns the index of the first range matching the language
+// tag, or -1 if none does. A range matches the tags it is a prefix of,
+// e.g. "nb" matches "nb-NO", and "*" matches any tag.
+func langRank(tag string, ranges []string) int {
+	tag = strings.ToLower(tag)
+	for i, rng := range ranges {
+		if rng == "*" || tag == rng || strings.HasPrefix(tag, rng+"-") {
+			return i
+		}
+	}
+	return -1
+}
+
+// filterLanguages keeps, of the language tagged literals of each subject
+// and predicate, only those in the most preferred language available. If
+// none of them are in an acceptable language, they are all kept. It
+// returns the filtered triples, and the languages kept by preference.
+func filterLanguages(trs []rdf.Triple, ranges []string) ([]rdf.Triple, []string) {
+	key := func(tr rdf.Triple) string { return tr.Subject.String() + " " + tr.Predicate.Name() }
+	best := make(map[string]int)
+	for _, tr := range trs {
+		l, ok := tr.Object.(rdf.Literal)
+		if !ok || l.Lang() == "" {
+			continue
+		}
+		k := key(tr)
+		rank := langRank(l.Lang(), ranges)
+		if b, ok := best[k]; !ok || b < 0 || (rank >= 0 && rank < b) {
+			best[k] = rank
+		}
+	}
+
+	var res []rdf.Triple
+	langRanks := make(map[string]int)
+	for _, tr := range trs {
+		if l, ok := tr.Object.(rdf.Literal); ok && l.Lang() != "" {
+			b := best[key(tr)]
+			if b >= 0 {
+				if langRank(l.Lang(), ranges) != b {
+					continue
+				}
+				langRanks[l.Lang()] = b
+			}
+		}
+		res = append(res, tr)
+	}
+	langs := make([]string, 0, len(langRanks))
+	for lang := range langRanks {
+		langs = append(langs, lang)
+	}
+	sort.Slice(langs, func(i, j int) bool {
+		if langRanks[langs[i]] != langRanks[langs[j]] {
+			return langRanks[langs[i]] < langRanks[langs[j]]
+		}
+		return langs[i] < langs[j]
+	})
+	return res, langs
+}
+
+// onlyLanguage removes the language tagged literals not matching the
+// language range lang, e.g. "nb". Untagged literals are kept.
+func onlyLanguage(trs []rdf.Triple, lang string) []rdf.Triple {
+	ranges := []string{strings.ToLower(lang)}
+	var res []rdf.Triple
+	for _, tr := range trs {
+		if l, ok := tr.Object.(rdf.Literal); ok && l.Lang() != "" && langRank(l.Lang(), ranges) < 0 {
+			continue
+		}
+		res = append(res, tr)
+	}
+	return res
+}
+
+// literalLanguages returns the language tags of the literals in trs,
+// lowercased and sorted.
+func literalLanguages(trs []rdf.Triple) []string {
+	seen := make(map[string]bool)
+	var langs []string
+	for _, tr := range trs {
+		if l, ok := tr.Object.(rdf.Literal); ok && l.Lang() != "" && !seen[strings.ToLower(l.Lang())] {
+			seen[strings.ToLower(l.Lang())] = true
+			langs = append(langs, strings.ToLower(l.Lang()))
+		}
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// languageLink links to the HTML view showing only the literals in a
+// language, or in all languages for "*".
+type languageLink struct {
+	Tag     string
+	Href    string
+	Current bool
+}
+
+// languageLinks returns the links filtering the HTML view by language,
+// if the resource has literals in more than one language.
+func (srv server) languageLinks() []languageLink {
+	if len(srv.languages) < 2 {
+		return nil
+	}
+	links := []languageLink{{Tag: "all", Href: "?lang=*", Current: srv.lang == "*"}}
+	for _, lang := range srv.languages {
+		links = append(links, languageLink{Tag: lang, Href: "?" + url.Values{"lang": {lang}}.Encode(), Current: srv.lang == lang})
+	}
+	return links
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// sdListenFDsStart is the first file descriptor passed by systemd socket
+// activation.
+const sdListenFDsStart = 3
+
+// systemdListeners returns the listening sockets passed by systemd, keyed
+// by their names (FileDescriptorName= in the socket unit). It returns nil
+// when not socket activated. See sd_listen_fds(3).
+func systemdListeners() (map[string][]net.Listener, error) {
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		return nil, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	ls := make(map[string][]net.Listener)
+	for i := 0; i < n; i++ {
+		fd := sdListenFDsStart + i
+		syscall.CloseOnExec(fd)
+		name := "unknown"
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		f := os.NewFile(uintptr(fd), name)
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("systemd: %s: %v", name, err)
+		}
+		ls[name] = append(ls[name], l)
+	}
+	return ls, nil
+}
+
+// listenAddr opens a listener on addr. Addresses on the form
+// unix:/path/to/socket listen on a unix domain socket with the given
+// octal file mode; the socket file is removed when the listener is closed.
+func listenAddr(addr, socketMode string) (net.Listener, error) {
+	if !strings.HasPrefix(addr, "unix:") {
+		return net.Listen("tcp", addr)
+	}
+	path := strings.TrimPrefix(addr, "unix:")
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		// Left behind by an unclean shutdown.
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if socketMode != "" {
+		mode, err := strconv.ParseUint(socketMode, 8, 32)
+		if err != nil {
+			l.Close()
+			return nil, fmt.Errorf("socket mode: %v", err)
+		}
+		if err := os.Chmod(path, os.FileMode(mode)); err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// listen opens the public and admin listeners. When started by systemd
+// socket activation, the sockets passed by systemd are used instead;
+// sockets named "admin" serve the admin handlers.
+func listen(cfg config) (public, admin []net.Listener, err error) {
+	sd, err := systemdListeners()
+	if err != nil {
+		return nil, nil, err
+	}
+	if sd != nil {
+		admin = sd["admin"]
+		delete(sd, "admin")
+		for _, ls := range sd {
+			public = append(public, ls...)
+		}
+		return public, admin, nil
+	}
+
+	closeAll := func() {
+		for _, l := range append(public, admin...) {
+			l.Close()
+		}
+	}
+	for _, addr := range cfg.Listen {
+		l, err := listenAddr(addr, cfg.SocketMode)
+		if err != nil {
+			closeAll()
+			return nil, nil, err
+		}
+		public = append(public, l)
+	}
+	for _, addr := range cfg.AdminListen {
+		l, err := listenAddr(addr, cfg.SocketMode)
+		if err != nil {
+			closeAll()
+			return nil, nil, err
+		}
+		admin = append(admin, l)
+	}
+	return public, admin, nil
+}
+
+// tlsConfig returns the TLS config for the public listeners, or nil when
+// TLS is not enabled.
+func tlsConfig(cfg config) (*tls.Config, error) {
+	switch {
+	case len(cfg.Autocert.Hosts) > 0:
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.Autocert.Hosts...),
+			Email:      cfg.Autocert.Email,
+		}
+		if cfg.Autocert.Cache != "" {
+			m.Cache = autocert.DirCache(cfg.Autocert.Cache)
+		}
+		return m.TLSConfig(), nil
+	case cfg.TLSCert != "":
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			return nil, err
+		}
+		return &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			NextProtos:   []string{"h2", "http/1.1"},
+		}, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/golang/gddo/httputil"
+)
+
+const maintenanceHTML = `<html><head><title>Down for maintenance</title></head><body>
+<h1>Down for maintenance</h1>
+<p>The data is being updated. Please try again in a few minutes.</p>
+</body></html>`
+
+// serveMaintenance responds with 503 Service Unavailable, telling the
+// client when to retry.
+func (srv server) serveMaintenance(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(srv.retryAfter.Seconds())))
+	if httputil.NegotiateContentType(r, []string{"text/plain", "text/html"}, "text/plain") == "text/html" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, maintenanceHTML)
+		return
+	}
+	http.Error(w, "down for maintenance", http.StatusServiceUnavailable)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/xml"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/knakk/kbp/rdf"
+)
+
+// marcLeader is the leader of MARC records: a bibliographic record of a
+// monograph, with the length and base address left for the receiver.
+const marcLeader = "00000nam a2200000 u 4500"
+
+type marcRecord struct {
+	XMLName       xml.Name           `xml:"http://www.loc.gov/MARC21/slim record"`
+	Leader        string             `xml:"leader"`
+	ControlFields []marcControlField `xml:"controlfield"`
+	DataFields    []*marcDataField   `xml:"datafield"`
+}
+
+type marcControlField struct {
+	Tag   string `xml:"tag,attr"`
+	Value string `xml:",chardata"`
+}
+
+type marcDataField struct {
+	Tag       string         `xml:"tag,attr"`
+	Ind1      string         `xml:"ind1,attr"`
+	Ind2      string         `xml:"ind2,attr"`
+	Subfields []marcSubfield `xml:"subfield"`
+}
+
+type marcSubfield struct {
+	Code  string `xml:"code,attr"`
+	Value string `xml:",chardata"`
+}
+
+// writeMARCXML writes the description as a MARCXML record, using the MARC
+// mapping. The record's control number is the last path segment of the
+// resource URI.
+//
+// Values of the same tag are collected in one field, unless the field
+// already has the subfield, in which case the value starts a new field.
+// Blank nodes are replaced by their value of a via property, as for the
+// schema.org mapping.
+func (srv server) writeMARCXML(w io.Writer, res resolution, trs []rdf.Triple) error {
+	node := rdf.NewNamedNode(res.uri)
+	rec := marcRecord{
+		Leader:        marcLeader,
+		ControlFields: []marcControlField{{Tag: "001", Value: path.Base(res.uri)}},
+	}
+	for _, m := range srv.marc {
+		for _, tr := range trs {
+			if tr.Subject != node || tr.Predicate.Name() != m.Predicate {
+				continue
+			}
+			v, ok := srv.marcValue(tr.Object, trs, m.LocalName)
+			if !ok {
+				continue
+			}
+			rec.add(m, v)
+		}
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(rec)
+}
+
+// add adds the value v to the record according to the mapping m.
+func (rec *marcRecord) add(m marcConfig, v string) {
+	var f *marcDataField
+	for _, df := range rec.DataFields {
+		if df.Tag == m.Tag {
+			f = df
+		}
+	}
+	if f != nil {
+		for _, sf := range f.Subfields {
+			if sf.Code == m.Code {
+				f = nil
+				break
+			}
+		}
+	}
+	if f == nil {
+		f = &marcDataField{Tag: m.Tag, Ind1: m.Ind1, Ind2: m.Ind2}
+		rec.DataFields = append(rec.DataFields, f)
+	}
+	f.Subfields = append(f.Subfields, marcSubfield{Code: m.Code, Value: v})
+}
+
+// marcValue returns the value of node as a MARC subfield value.
+func (srv server) marcValue(node rdf.Node, trs []rdf.Triple, localName bool) (string, bool) {
+	switch n := node.(type) {
+	case rdf.Literal:
+		return n.ValueAsString(), true
+	case rdf.NamedNode:
+		if localName {
+			iri := n.Name()
+			return iri[strings.LastIndexAny(iri, "/#")+1:], true
+		}
+		return n.Name(), true
+	case rdf.BlankNode:
+		for _, via := range srv.schema.via {
+			for _, tr := range trs {
+				if tr.Subject == node && tr.Predicate.Name() == via {
+					if _, ok := tr.Object.(rdf.BlankNode); !ok {
+						return srv.marcValue(tr.Object, trs, localName)
+					}
+				}
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+)
+
+// HTML modes.
+const (
+	htmlTurtle    = "turtle"
+	htmlMicrodata = "microdata"
+)
+
+// writeMicrodata renders the schema.org description obj as a HTML page
+// annotated with microdata.
+func (srv server) writeMicrodata(w io.Writer, res resolution, obj jsonldObject) error {
+	s := htmlStyle{srv: srv, rt: res.route}
+	var types []string
+	for _, t := range schemaValues(obj["@type"]) {
+		types = append(types, schemaOrgContext+"/"+t.(string))
+	}
+	title := res.uri
+	if names := schemaValues(obj["name"]); len(names) > 0 {
+		if name, ok := names[0].(string); ok {
+			title = name
+		}
+	}
+
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "<div itemscope itemtype=\"%s\" itemid=\"%s\">\n<h1>%s</h1>\n<dl>\n",
+		html.EscapeString(strings.Join(types, " ")), html.EscapeString(res.uri), html.EscapeString(title))
+	var props []string
+	for k := range obj {
+		if !strings.HasPrefix(k, "@") {
+			props = append(props, k)
+		}
+	}
+	sort.Strings(props)
+	for _, prop := range props {
+		fmt.Fprintf(&body, "<dt>%s</dt>\n", html.EscapeString(prop))
+		for _, v := range schemaValues(obj[prop]) {
+			switch v := v.(type) {
+			case string:
+				fmt.Fprintf(&body, "<dd itemprop=\"%s\">%s</dd>\n", html.EscapeString(prop), html.EscapeString(v))
+			case jsonldObject:
+				iri := v["@id"].(string)
+				href, text := iri, iri
+				if rel, ok := s.link(iri); ok {
+					href, text = res.prefix+"/"+rel, rel
+				}
+				fmt.Fprintf(&body, "<dd><a itemprop=\"%s\" href=\"%s\">%s</a></dd>\n",
+					html.EscapeString(prop), escapeHref(href), html.EscapeString(text))
+			}
+		}
+	}
+	body.WriteString("</dl>\n</div>\n")
+	page := srv.resourcePage(res)
+	page.Title = title
+	page.Body = template.HTML(body.String())
+	return srv.writeHTMLPage(w, htmlMicrodata, page)
+}
+
+// schemaValues returns the values of a property of a schema.org
+// description, which holds either a single value or a list.
+func schemaValues(v interface{}) []interface{} {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return v
+	}
+	return []interface{}{v}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/knakk/kbp/rdf"
+)
+
+// pageQuery returns a page of the triples matching a pattern, ordered so
+// that the pages don't overlap. The inner SELECT is Virtuoso's way of
+// scrolling through results beyond ResultSetMaxRows. Virtuoso labels
+// blank nodes by their internal ids, so they are the same from page to
+// page.
+const pageQuery = `CONSTRUCT { ?s ?p ?o } WHERE { { SELECT DISTINCT ?s ?p ?o WHERE { %s } ORDER BY ?s ?p ?o LIMIT %d OFFSET %d } }`
+
+// pagePattern returns the pattern of the triples depth steps from the
+// resource: its own triples at depth 0, and otherwise those of the blank
+// nodes reached from it through depth-1 other blank nodes. Blank nodes
+// can't be named in queries, so they are reached by their paths.
+func pagePattern(uri string, depth int) string {
+	if depth == 0 {
+		return fmt.Sprintf("<%s> ?p ?o BIND (<%[1]s> AS ?s)", uri)
+	}
+	var b strings.Builder
+	prev := "<" + uri + ">"
+	for i := 1; i <= depth; i++ {
+		node := fmt.Sprintf("?b%d", i)
+		if i == depth {
+			node = "?s"
+		}
+		fmt.Fprintf(&b, "%s ?q%d %s FILTER (isBlank(%s)) . ", prev, i, node, node)
+		prev = node
+	}
+	b.WriteString("?s ?p ?o")
+	return b.String()
+}
+
+// capped reports whether the description trs of the resource may have
+// been cut off by the maximum number of rows of the endpoint, and should
+// be fetched in pages. Only plain DESCRIBE queries are paged, and only if
+// the triple limit doesn't cut the description off first.
+func (srv server) capped(res resolution, trs []rdf.Triple) bool {
+	if srv.maxRows == 0 || len(trs) < srv.maxRows || srv.tripleLimit > 0 && srv.tripleLimit < srv.maxRows {
+		return false
+	}
+	_, ok := describePrefix(res)
+	return ok
+}
+
+// fetchPages fetches the description of the resource in pages of the
+// maximum number of rows of the endpoint, until the triple limit is
+// reached. It covers the triples of the resource and of the blank nodes
+// it leads to, however deeply nested: they are fetched a level at a
+// time, until a level leads to no blank nodes not described yet.
+func (srv server) fetchPages(res resolution) ([]rdf.Triple, error) {
+	var trs []rdf.Triple
+	described := make(map[rdf.Node]bool)
+	for depth := 0; ; depth++ {
+		level, err := srv.fetchLevel(res, depth)
+		if err != nil {
+			return nil, err
+		}
+		// Blank nodes reached through cycles, or by paths of different
+		// lengths, are described once.
+		subjects := make(map[rdf.Node]bool)
+		for _, tr := range level {
+			if !described[tr.Subject] {
+				subjects[tr.Subject] = true
+				trs = append(trs, tr)
+			}
+		}
+		for s := range subjects {
+			described[s] = true
+		}
+		if srv.tripleLimit > 0 && len(trs) > srv.tripleLimit {
+			return trs, nil
+		}
+		more := false
+		for _, tr := range level {
+			if _, ok := tr.Object.(rdf.BlankNode); ok && subjects[tr.Subject] && !described[tr.Object] {
+				more = true
+			}
+		}
+		if !more {
+			return trs, nil
+		}
+	}
+}
+
+// fetchLevel fetches the triples depth steps from the resource, in pages,
+// until a page comes back short or the triple limit is reached.
+func (srv server) fetchLevel(res resolution, depth int) ([]rdf.Triple, error) {
+	var trs []rdf.Triple
+	pattern := pagePattern(res.uri, depth)
+	for offset := 0; ; offset += srv.maxRows {
+		page, err := srv.fetch(res.graph, fmt.Sprintf(pageQuery, pattern, srv.maxRows, offset), 0)
+		if err != nil {
+			return nil, err
+		}
+		trs = append(trs, page...)
+		if len(page) < srv.maxRows || srv.tripleLimit > 0 && len(trs) > srv.tripleLimit {
+			return trs, nil
+		}
+	}
+}
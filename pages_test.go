@@ -0,0 +1,142 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testLevels are the triples of the test work at each depth: those of
+// the work, of its contribution and subject, and of the role of the
+// contribution, which links back to the contribution.
+var testLevels = [][]string{
+	{
+		`<http://data.deichman.no/work/w1> <http://purl.org/dc/terms/title> "Sult" .`,
+		`<http://data.deichman.no/work/w1> <http://data.deichman.no/ontology#contributor> _:c1 .`,
+		`<http://data.deichman.no/work/w1> <http://data.deichman.no/ontology#subject> _:s1 .`,
+		`<http://data.deichman.no/work/w1> <http://data.deichman.no/ontology#year> "1890" .`,
+	},
+	{
+		`_:c1 <http://data.deichman.no/ontology#agent> <http://data.deichman.no/person/p1> .`,
+		`_:c1 <http://data.deichman.no/ontology#role> _:r1 .`,
+		`_:s1 <http://www.w3.org/2000/01/rdf-schema#label> "Hunger" .`,
+	},
+	{
+		`_:r1 <http://www.w3.org/2000/01/rdf-schema#label> "Author" .`,
+		`_:r1 <http://www.w3.org/2000/01/rdf-schema#seeAlso> _:c1 .`,
+	},
+	// The contribution again, through the role, which is not asked for.
+	{
+		`_:c1 <http://data.deichman.no/ontology#agent> <http://data.deichman.no/person/p1> .`,
+		`_:c1 <http://data.deichman.no/ontology#role> _:r1 .`,
+	},
+}
+
+var rgxpTestPage = regexp.MustCompile(`LIMIT (\d+) OFFSET (\d+)`)
+
+// testPagedEndpoint serves the pages of the test levels, going by the
+// number of blank nodes in the path of the pattern and the LIMIT and
+// OFFSET of the query. It records the depths asked for.
+func testPagedEndpoint(t *testing.T, depths *[]int, mu *sync.Mutex) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.FormValue("query")
+		m := rgxpTestPage.FindStringSubmatch(q)
+		if m == nil {
+			t.Errorf("not a page query: %s", q)
+			http.Error(w, "not a page query", http.StatusBadRequest)
+			return
+		}
+		limit, _ := strconv.Atoi(m[1])
+		offset, _ := strconv.Atoi(m[2])
+		depth := strings.Count(q, "isBlank(")
+		mu.Lock()
+		*depths = append(*depths, depth)
+		mu.Unlock()
+		var lines []string
+		if depth < len(testLevels) {
+			lines = testLevels[depth]
+		}
+		if offset > len(lines) {
+			offset = len(lines)
+		}
+		if offset+limit < len(lines) {
+			lines = lines[:offset+limit]
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, l := range lines[offset:] {
+			w.Write([]byte(l + "\n"))
+		}
+	}))
+}
+
+func TestFetchPagesNestedBlankNodes(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		depths []int
+	)
+	endpoint := testPagedEndpoint(t, &depths, &mu)
+	defer endpoint.Close()
+
+	// Two rows a page, so that the work and the contribution take more
+	// than one page each, and the role is only reached on a later one.
+	srv := server{endpoints: []string{endpoint.URL}, maxRows: 2}
+	trs, err := srv.fetchPages(resolution{uri: testWork})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]bool)
+	for _, tr := range trs {
+		got[ntriple(tr)] = true
+	}
+	if len(trs) != len(got) {
+		t.Errorf("fetchPages returned %d triples, %d of them different", len(trs), len(got))
+	}
+	var want int
+	for _, level := range testLevels[:3] {
+		want += len(level)
+	}
+	if len(trs) != want {
+		t.Errorf("fetchPages returned %d triples, want %d", len(trs), want)
+	}
+	var labels int
+	for _, tr := range trs {
+		if tr.Predicate.Name() == "http://www.w3.org/2000/01/rdf-schema#label" {
+			labels++
+		}
+	}
+	if labels != 2 {
+		t.Errorf("fetchPages returned %d labels, want those of the subject and of the nested role", labels)
+	}
+
+	// The cycle back to the contribution ends the levels.
+	mu.Lock()
+	defer mu.Unlock()
+	if max := depths[len(depths)-1]; max != 2 {
+		t.Errorf("fetchPages went down to depth %d, want 2", max)
+	}
+	for _, d := range depths {
+		if d > 2 {
+			t.Errorf("fetchPages asked for depth %d, beyond the cycle", d)
+		}
+	}
+}
+
+func TestPagePattern(t *testing.T) {
+	tests := []struct {
+		depth int
+		want  string
+	}{
+		{0, "<http://data.deichman.no/work/w1> ?p ?o BIND (<http://data.deichman.no/work/w1> AS ?s)"},
+		{1, "<http://data.deichman.no/work/w1> ?q1 ?s FILTER (isBlank(?s)) . ?s ?p ?o"},
+		{2, "<http://data.deichman.no/work/w1> ?q1 ?b1 FILTER (isBlank(?b1)) . ?b1 ?q2 ?s FILTER (isBlank(?s)) . ?s ?p ?o"},
+	}
+	for _, test := range tests {
+		if got := pagePattern(testWork, test.depth); got != test.want {
+			t.Errorf("pagePattern(%d) = %q, want %q", test.depth, got, test.want)
+		}
+	}
+}
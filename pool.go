@@ -0,0 +1,115 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// replicaDownFor is how long an endpoint is passed over after a query to
+// it failed. The next query after that checks whether it is back.
+const replicaDownFor = 15 * time.Second
+
+// poolTransport sends the queries to the main endpoint to it or one of
+// its replicas. The endpoints are tried in order, or in turn when
+// balancing, with the ones found down last. A query failing with an error
+// or a server error response is sent to the next endpoint, and the one
+// failing is passed over for a while.
+type poolTransport struct {
+	next      http.RoundTripper
+	main      string
+	endpoints []*url.URL
+	balance   bool
+	turn      uint32
+
+	mu        sync.Mutex
+	downUntil []time.Time
+}
+
+func newPoolTransport(next http.RoundTripper, main string, replicas []string) (*poolTransport, error) {
+	t := &poolTransport{next: next, main: main, downUntil: make([]time.Time, len(replicas)+1)}
+	for _, endpoint := range append([]string{main}, replicas...) {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		t.endpoints = append(t.endpoints, u)
+	}
+	return t, nil
+}
+
+// CloseIdleConnections closes the idle connections of the wrapped
+// transport.
+func (t *poolTransport) CloseIdleConnections() {
+	closeIdleConnections(t.next)
+}
+
+// order returns the indexes of the endpoints in the order they are tried.
+func (t *poolTransport) order() []int {
+	start := 0
+	if t.balance {
+		start = int(atomic.AddUint32(&t.turn, 1) % uint32(len(t.endpoints)))
+	}
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var up, down []int
+	for i := range t.endpoints {
+		n := (start + i) % len(t.endpoints)
+		if now.Before(t.downUntil[n]) {
+			down = append(down, n)
+		} else {
+			up = append(up, n)
+		}
+	}
+	return append(up, down...)
+}
+
+func (t *poolTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.String() != t.main {
+		return t.next.RoundTrip(req)
+	}
+	order := t.order()
+	for i, n := range order {
+		r := req.Clone(req.Context())
+		u := *t.endpoints[n]
+		r.URL, r.Host = &u, u.Host
+		if i > 0 && req.Body != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r.Body = body
+		}
+		resp, err := t.next.RoundTrip(r)
+		failed := err != nil && req.Context().Err() == nil || err == nil && resp.StatusCode >= 500
+		last := i == len(order)-1 || req.Body != nil && req.GetBody == nil
+		t.mu.Lock()
+		wasDown := !t.downUntil[n].IsZero()
+		if failed {
+			if !wasDown {
+				log.Printf("%s: failing over from %s", t.main, u.Host)
+			}
+			t.downUntil[n] = time.Now().Add(replicaDownFor)
+		} else if err == nil {
+			if wasDown {
+				log.Printf("%s: %s is back", t.main, u.Host)
+			}
+			t.downUntil[n] = time.Time{}
+		}
+		t.mu.Unlock()
+		if !failed || last {
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<16))
+			resp.Body.Close()
+		}
+	}
+	panic("unreachable")
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// prefixClient fetches prefix tables, so that an unresponsive server
+// doesn't hold up startup or reloads.
+var prefixClient = &http.Client{Timeout: 10 * time.Second}
+
+// loadPrefixes reads a prefix table from a file or http(s) URL, in one of
+// the formats offered by prefix.cc:
+//
+//	JSON:       {"foaf": "http://xmlns.com/foaf/0.1/"}
+//	JSON-LD:    {"@context": {"foaf": "http://xmlns.com/foaf/0.1/"}}
+//	Turtle:     @prefix foaf: <http://xmlns.com/foaf/0.1/> .
+//	SPARQL:     PREFIX foaf: <http://xmlns.com/foaf/0.1/>
+func loadPrefixes(src string) (map[string]string, error) {
+	var (
+		b   []byte
+		err error
+	)
+	if strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") {
+		var resp *http.Response
+		resp, err = prefixClient.Get(src)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("prefixes: %s: %s", src, resp.Status)
+		}
+		b, err = ioutil.ReadAll(resp.Body)
+	} else {
+		b, err = ioutil.ReadFile(src)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	b = bytes.TrimSpace(b)
+	if bytes.HasPrefix(b, []byte("{")) {
+		var doc map[string]json.RawMessage
+		if err := json.Unmarshal(b, &doc); err != nil {
+			return nil, fmt.Errorf("prefixes: %s: %v", src, err)
+		}
+		if ctx, ok := doc["@context"]; ok {
+			doc = nil
+			if err := json.Unmarshal(ctx, &doc); err != nil {
+				return nil, fmt.Errorf("prefixes: %s: %v", src, err)
+			}
+		}
+		prefixes := make(map[string]string, len(doc))
+		for name, v := range doc {
+			var ns string
+			if err := json.Unmarshal(v, &ns); err != nil {
+				// Not a plain prefix mapping, e.g. a term definition.
+				continue
+			}
+			prefixes[name] = ns
+		}
+		return prefixes, nil
+	}
+
+	prefixes := make(map[string]string)
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for line := 1; sc.Scan(); line++ {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) < 3 || !strings.EqualFold(strings.TrimPrefix(fields[0], "@"), "prefix") ||
+			!strings.HasSuffix(fields[1], ":") ||
+			!strings.HasPrefix(fields[2], "<") || !strings.HasSuffix(fields[2], ">") {
+			return nil, fmt.Errorf("prefixes: %s:%d: not a prefix declaration", src, line)
+		}
+		prefixes[strings.TrimSuffix(fields[1], ":")] = strings.Trim(fields[2], "<>")
+	}
+	return prefixes, sc.Err()
+}
+
+// compactIRI abbreviates iri using the longest matching namespace in the
+// prefix table. It returns iri unchanged if no namespace matches.
+func (srv server) compactIRI(iri string) string {
+	var prefix, ns string
+	for name, n := range srv.prefixes {
+		if len(n) > len(ns) && strings.HasPrefix(iri, n) {
+			prefix, ns = name, n
+		}
+	}
+	if ns == "" {
+		return iri
+	}
+	return prefix + ":" + iri[len(ns):]
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/knakk/kbp/rdf"
+	"golang.org/x/sync/singleflight"
+)
+
+// previewPath is where the labels of external resources are served, for
+// the hover cards of the HTML view.
+const previewPath = "/preview"
+
+// previewMaxBody is the maximum size of the documents read when
+// dereferencing external resources.
+const previewMaxBody = 1 << 20
+
+// previewLabels are the predicates giving the labels of external
+// resources, in order of preference.
+var previewLabels = []string{
+	skosPrefLabel,
+	"http://www.w3.org/2000/01/rdf-schema#label",
+	"http://schema.org/name",
+	"http://xmlns.com/foaf/0.1/name",
+}
+
+var rgxpTitle = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+// previews caches the labels of external resources.
+type previews struct {
+	cfg previewConfig
+	// client dereferences the external resources.
+	client *http.Client
+
+	// fetches coalesces concurrent dereferencing of the same resource.
+	fetches singleflight.Group
+
+	mu      sync.Mutex
+	entries map[string]previewEntry
+}
+
+type previewEntry struct {
+	label   string
+	fetched time.Time
+}
+
+func newPreviews(cfg previewConfig) *previews {
+	p := &previews{cfg: cfg, entries: make(map[string]previewEntry)}
+	p.client = &http.Client{
+		Timeout: 5 * time.Second,
+		// Redirects are only followed to allowed hosts, so that an
+		// allowed host can't send the request to an internal address.
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			if !p.allowed(req.URL.String()) {
+				return fmt.Errorf("redirect to %s is not allowed", req.URL.Host)
+			}
+			return nil
+		},
+	}
+	return p
+}
+
+// allowed reports whether the resource iri is on one of the hosts which
+// may be dereferenced.
+func (p *previews) allowed(iri string) bool {
+	u, err := url.Parse(iri)
+	if err != nil || u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+	for _, host := range p.cfg.Hosts {
+		if u.Hostname() == host || strings.HasSuffix(u.Hostname(), "."+host) {
+			return true
+		}
+	}
+	return false
+}
+
+// label returns the label of the external resource iri, dereferencing it
+// unless it is cached. Failures are cached too, as an empty label, so that
+// slow or broken hosts are not asked again until the TTL has passed.
+// Concurrent lookups of the same resource share one fetch, which is
+// given up on when the request that started it is, and not cached then.
+func (p *previews) label(ctx context.Context, iri string) string {
+	p.mu.Lock()
+	e, ok := p.entries[iri]
+	p.mu.Unlock()
+	if ok && time.Since(e.fetched) < p.cfg.TTL {
+		return e.label
+	}
+	ch := p.fetches.DoChan(iri, func() (interface{}, error) {
+		label, _ := p.dereferenceLabel(ctx, iri)
+		if ctx.Err() == nil {
+			p.add(iri, label)
+		}
+		return label, nil
+	})
+	select {
+	case r := <-ch:
+		return r.Val.(string)
+	case <-ctx.Done():
+		return ""
+	}
+}
+
+// add caches the label of iri. When the cache is full, expired entries
+// are dropped first, and else the oldest one.
+func (p *previews) add(iri, label string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.entries) >= p.cfg.CacheSize {
+		for k, e := range p.entries {
+			if time.Since(e.fetched) >= p.cfg.TTL {
+				delete(p.entries, k)
+			}
+		}
+	}
+	for len(p.entries) > 0 && len(p.entries) >= p.cfg.CacheSize {
+		var oldest string
+		var fetched time.Time
+		for k, e := range p.entries {
+			if oldest == "" || e.fetched.Before(fetched) {
+				oldest, fetched = k, e.fetched
+			}
+		}
+		delete(p.entries, oldest)
+	}
+	p.entries[iri] = previewEntry{label: label, fetched: time.Now()}
+}
+
+// dereferenceLabel fetches the external resource iri, asking for
+// N-Triples, and returns its label. HTML documents are labeled by their
+// title.
+func (p *previews) dereferenceLabel(ctx context.Context, iri string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", iri, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/n-triples, text/plain;q=0.9, text/html;q=0.5")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: %s", iri, resp.Status)
+	}
+	if err := utf8Body(resp); err != nil {
+		return "", err
+	}
+	body := io.LimitReader(resp.Body, previewMaxBody)
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/n-triples", "text/plain":
+		trs, err := decodeTriples(body, 0)
+		if err != nil {
+			return "", err
+		}
+		// The resource may have been redirected to, e.g. from an http
+		// to an https URI, so its final URI is accepted as well.
+		subjects := map[string]bool{iri: true, resp.Request.URL.String(): true}
+		for _, pred := range previewLabels {
+			for _, tr := range trs {
+				subj, ok := tr.Subject.(rdf.NamedNode)
+				if !ok || !subjects[subj.Name()] || tr.Predicate.Name() != pred {
+					continue
+				}
+				if l, ok := tr.Object.(rdf.Literal); ok {
+					return l.ValueAsString(), nil
+				}
+			}
+		}
+		return "", nil
+	case "text/html":
+		b, err := ioutil.ReadAll(body)
+		if err != nil {
+			return "", err
+		}
+		if m := rgxpTitle.FindSubmatch(b); m != nil {
+			return strings.TrimSpace(html.UnescapeString(string(m[1]))), nil
+		}
+		return "", nil
+	}
+	return "", fmt.Errorf("%s: unsupported content type %q", iri, mediaType)
+}
+
+// servePreview serves the label of the external resource given by the uri
+// parameter, as a JSON object.
+func (srv server) servePreview(w http.ResponseWriter, r *http.Request) {
+	iri := r.FormValue("uri")
+	if !srv.previews.allowed(iri) {
+		http.Error(w, fmt.Sprintf("not allowed to preview %q", iri), http.StatusForbidden)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", int(srv.previews.cfg.TTL.Seconds())))
+	json.NewEncoder(w).Encode(map[string]string{"uri": iri, "label": srv.previews.label(r.Context(), iri)})
+}
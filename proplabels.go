@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const propertyLabelQuery = `SELECT ?p ?label (lang(?label) AS ?lang) WHERE { ?p <http://www.w3.org/2000/01/rdf-schema#label> ?label FILTER (isIRI(?p) && isLiteral(?label)) }`
+
+// HTML views, selected by the view parameter and remembered in the
+// viewCookie cookie.
+const (
+	viewTurtle = "turtle"
+	viewLabels = "labels"
+	viewCookie = "vindu-view"
+)
+
+// propertyLabels caches the labels of the properties of the ontology
+// graph, for the label view.
+type propertyLabels struct {
+	cfg propertyLabelConfig
+
+	mu      sync.Mutex
+	labels  map[string]string
+	fetched time.Time
+}
+
+func newPropertyLabels(cfg propertyLabelConfig) *propertyLabels {
+	return &propertyLabels{cfg: cfg}
+}
+
+// get returns the label of the property p, if it has one. The labels are
+// fetched from endpoint when they are older than the cache TTL. If that
+// fails, the error is logged and the old labels are used.
+func (pl *propertyLabels) get(endpoint, p string) (string, bool) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	if pl.labels == nil || time.Since(pl.fetched) > pl.cfg.TTL {
+		if err := pl.fetch(endpoint); err != nil {
+			log.Printf("looking up property labels: %v", err)
+		}
+	}
+	label, ok := pl.labels[p]
+	return label, ok
+}
+
+// fetch replaces the labels with the ones in the ontology graph. Labels in
+// the preferred language win over others. The labels are shared by all
+// requests, so the lookup is not canceled with the request causing it.
+func (pl *propertyLabels) fetch(endpoint string) error {
+	// Failures are retried after the TTL, like successful lookups.
+	pl.fetched = time.Now()
+	rows, err := selectRows(context.Background(), endpoint, pl.cfg.Graph, propertyLabelQuery)
+	if err != nil {
+		return err
+	}
+	labels := make(map[string]string)
+	preferred := make(map[string]bool)
+	for _, row := range rows {
+		p := row["p"]
+		if preferred[p] {
+			continue
+		}
+		if _, ok := labels[p]; ok && row["lang"] != pl.cfg.Lang {
+			continue
+		}
+		labels[p], preferred[p] = row["label"], row["lang"] == pl.cfg.Lang
+	}
+	pl.labels = labels
+	return nil
+}
+
+// requestedView returns the HTML view asked for by the view parameter of
+// r, remembering it in a cookie, or else the view remembered.
+func requestedView(w http.ResponseWriter, r *http.Request) string {
+	if view := r.URL.Query().Get("view"); view == viewTurtle || view == viewLabels {
+		http.SetCookie(w, &http.Cookie{Name: viewCookie, Value: view, Path: "/", MaxAge: 365 * 24 * 60 * 60})
+		return view
+	}
+	if c, err := r.Cookie(viewCookie); err == nil && c.Value == viewLabels {
+		return viewLabels
+	}
+	return viewTurtle
+}
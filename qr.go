@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"rsc.io/qr"
+)
+
+// qrPath is where QR codes of resource URIs are served.
+const qrPath = "/qr"
+
+// qrURL returns the URL of the QR code of the resource uri.
+func qrURL(uri string) string {
+	return qrPath + "?" + url.Values{"uri": {uri}}.Encode()
+}
+
+// serveQR serves a QR code of the uri parameter as a PNG image. Only the
+// URIs of the resources served by vindu are encoded.
+func (srv server) serveQR(w http.ResponseWriter, r *http.Request) {
+	uri := r.FormValue("uri")
+	known := false
+	for _, rt := range srv.routes {
+		if strings.HasPrefix(uri, rt.base+"/") {
+			known = true
+			break
+		}
+	}
+	if !known {
+		http.Error(w, fmt.Sprintf("not a resource URI: %q", uri), http.StatusBadRequest)
+		return
+	}
+	code, err := qr.Encode(uri, qr.M)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "max-age=86400")
+	w.Write(code.PNG())
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// queryEditorPath is where the query editor of the SPARQL endpoint is
+// served.
+const queryEditorPath = "/query"
+
+// serveQueryEditor serves the query editor, running queries against the
+// SPARQL endpoint of vindu and showing the results as a table. The query
+// parameter fills in the editor, which otherwise starts with the prefix
+// declarations and a query for a few triples.
+func (srv server) serveQueryEditor(w http.ResponseWriter, r *http.Request) {
+	q := r.FormValue("query")
+	if q == "" {
+		names := make([]string, 0, len(srv.prefixes))
+		for name := range srv.prefixes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		var b strings.Builder
+		for _, name := range names {
+			b.WriteString("PREFIX " + name + ": <" + srv.prefixes[name] + ">\n")
+		}
+		b.WriteString("\nSELECT * WHERE {\n  ?s ?p ?o\n}\nLIMIT 10\n")
+		q = b.String()
+	}
+	f, _ := formatByName("html")
+	w.Header().Set("Content-Type", f.contentType())
+	err := srv.writeHTMLPage(w, "query", htmlPage{
+		Title:  "SPARQL query",
+		SPARQL: q,
+	})
+	if err != nil {
+		log.Println(err)
+	}
+}
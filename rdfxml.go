@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/knakk/kbp/rdf"
+)
+
+const rdfNS = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+
+// rgxpNCName matches the XML names we use as local names and prefixes. It
+// is a conservative subset of what XML allows.
+var rgxpNCName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+func xmlEscape(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// xmlNames assigns qualified names to predicates, using the prefix table
+// where possible.
+type xmlNames struct {
+	prefixes []xmlPrefix       // longest namespace first
+	taken    map[string]bool   // prefixes which can't be generated
+	names    map[string]string // namespace -> prefix
+	order    []string
+}
+
+type xmlPrefix struct {
+	name, ns string
+}
+
+// newXMLNames indexes the usable prefixes of the table by namespace, the
+// longest first and by name between equal ones, so that the choice of
+// prefix doesn't depend on map order.
+func newXMLNames(prefixes map[string]string) *xmlNames {
+	xn := &xmlNames{
+		taken: map[string]bool{"rdf": true, "xml": true},
+		names: map[string]string{rdfNS: "rdf"},
+	}
+	for name, ns := range prefixes {
+		xn.taken[name] = true
+		if rgxpNCName.MatchString(name) && (name != "rdf" || ns == rdfNS) {
+			xn.prefixes = append(xn.prefixes, xmlPrefix{name, ns})
+		}
+	}
+	sort.Slice(xn.prefixes, func(i, j int) bool {
+		a, b := xn.prefixes[i], xn.prefixes[j]
+		if len(a.ns) != len(b.ns) {
+			return len(a.ns) > len(b.ns)
+		}
+		return a.name < b.name
+	})
+	return xn
+}
+
+// qname returns the qualified name of the predicate iri.
+func (xn *xmlNames) qname(iri string) (string, error) {
+	var ns, prefix string
+	for _, p := range xn.prefixes {
+		if strings.HasPrefix(iri, p.ns) && rgxpNCName.MatchString(iri[len(p.ns):]) {
+			ns, prefix = p.ns, p.name
+			break
+		}
+	}
+	if ns == "" {
+		i := strings.LastIndexAny(iri, "#/")
+		if i < 0 || !rgxpNCName.MatchString(iri[i+1:]) {
+			return "", fmt.Errorf("rdf/xml: cannot abbreviate predicate <%s>", iri)
+		}
+		ns = iri[:i+1]
+	}
+	if p, ok := xn.names[ns]; ok {
+		prefix = p
+	} else {
+		// Generated prefixes skip those of the table, which may be
+		// declared for other namespaces.
+		for n := len(xn.order); prefix == ""; n++ {
+			if p := fmt.Sprintf("ns%d", n); !xn.taken[p] {
+				prefix = p
+			}
+		}
+		xn.taken[prefix] = true
+		xn.names[ns] = prefix
+		xn.order = append(xn.order, ns)
+	}
+	return prefix + ":" + iri[len(ns):], nil
+}
+
+// writeRDFXML writes the description as RDF/XML, declaring the namespaces
+// of the prefix table which are used. Blank nodes are given by node IDs.
+func (srv server) writeRDFXML(w io.Writer, res resolution, trs []rdf.Triple) error {
+	xn := newXMLNames(srv.prefixes)
+	qnames := make([]string, len(trs))
+	for i, tr := range trs {
+		qn, err := xn.qname(tr.Predicate.Name())
+		if err != nil {
+			return err
+		}
+		qnames[i] = qn
+	}
+
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	b.WriteString(`<rdf:RDF xmlns:rdf="` + rdfNS + `"`)
+	for _, ns := range xn.order {
+		fmt.Fprintf(&b, "\n\txmlns:%s=\"%s\"", xn.names[ns], xmlEscape(ns))
+	}
+	b.WriteString(">\n")
+
+	var cur rdf.Node
+	for i, tr := range trs {
+		if tr.Subject != cur {
+			if cur != nil {
+				b.WriteString("\t</rdf:Description>\n")
+			}
+			cur = tr.Subject
+			fmt.Fprintf(&b, "\t<rdf:Description %s>\n", xmlNodeAttr("about", tr.Subject))
+		}
+		switch obj := tr.Object.(type) {
+		case rdf.Literal:
+			attr := ""
+			if obj.Lang() != "" {
+				attr = fmt.Sprintf(` xml:lang="%s"`, xmlEscape(obj.Lang()))
+			} else if dt := obj.DataType().Name(); dt != "" && dt != xsdString {
+				attr = fmt.Sprintf(` rdf:datatype="%s"`, xmlEscape(dt))
+			}
+			fmt.Fprintf(&b, "\t\t<%s%s>%s</%[1]s>\n", qnames[i], attr, xmlEscape(obj.ValueAsString()))
+		default:
+			fmt.Fprintf(&b, "\t\t<%s %s/>\n", qnames[i], xmlNodeAttr("resource", tr.Object))
+		}
+	}
+	if cur != nil {
+		b.WriteString("\t</rdf:Description>\n")
+	}
+	b.WriteString("</rdf:RDF>\n")
+	_, err := b.WriteTo(w)
+	return err
+}
+
+// xmlNodeAttr returns the attribute identifying node, using attr for named
+// nodes and rdf:nodeID for blank nodes.
+func xmlNodeAttr(attr string, node rdf.Node) string {
+	if n, ok := node.(rdf.NamedNode); ok {
+		return fmt.Sprintf(`rdf:%s="%s"`, attr, xmlEscape(n.Name()))
+	}
+	return fmt.Sprintf(`rdf:nodeID="%s"`, xmlEscape(strings.TrimPrefix(node.String(), "_:")))
+}
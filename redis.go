@@ -0,0 +1,137 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/knakk/kbp/rdf"
+)
+
+// redisPrefix prefixes the keys of the cache in Redis.
+const redisPrefix = "vindu:"
+
+// redisCache caches descriptions in Redis, shared by all instances of
+// vindu. Descriptions are stored as N-Triples, after a line with the time
+// they were fetched, and expire by their TTL and the staleness window.
+// Sets of the keys of the descriptions of each resource and graph let
+// them be evicted. Failing requests to Redis are logged, and treated as
+// misses.
+type redisCache struct {
+	cfg  cacheConfig
+	pool *redis.Pool
+}
+
+func newRedisCache(cfg cacheConfig) *redisCache {
+	return &redisCache{cfg: cfg, pool: &redis.Pool{
+		MaxIdle:     8,
+		IdleTimeout: 5 * time.Minute,
+		Dial: func() (redis.Conn, error) {
+			return redis.DialURL(cfg.Redis,
+				redis.DialConnectTimeout(time.Second),
+				redis.DialReadTimeout(time.Second),
+				redis.DialWriteTimeout(time.Second))
+		},
+	}}
+}
+
+// redisKey returns the key of the description of the resource.
+func redisKey(res resolution) string {
+	sum := sha1.Sum([]byte(cacheKey(res)))
+	return redisPrefix + "desc:" + hex.EncodeToString(sum[:])
+}
+
+func (c *redisCache) get(res resolution) ([]rdf.Triple, bool, bool) {
+	conn := c.pool.Get()
+	defer conn.Close()
+	v, err := redis.String(conn.Do("GET", redisKey(res)))
+	if err != nil {
+		if err != redis.ErrNil {
+			log.Printf("redis cache: %v", err)
+		}
+		return nil, false, false
+	}
+	var fetched int64
+	i := strings.IndexByte(v, '\n')
+	if i >= 0 {
+		fetched, err = strconv.ParseInt(v[:i], 10, 64)
+	}
+	if i < 0 || err != nil {
+		log.Printf("redis cache: invalid entry %s", redisKey(res))
+		return nil, false, false
+	}
+	trs, err := decodeTriples(strings.NewReader(v[i+1:]), 0)
+	if err != nil {
+		log.Printf("redis cache: %v", err)
+		return nil, false, false
+	}
+	return trs, time.Since(time.Unix(0, fetched)) >= c.cfg.ttl(trs), true
+}
+
+func (c *redisCache) add(res resolution, trs []rdf.Triple) {
+	ttl := c.cfg.ttl(trs)
+	if ttl == 0 {
+		return
+	}
+	var v strings.Builder
+	v.WriteString(strconv.FormatInt(time.Now().UnixNano(), 10) + "\n")
+	for _, tr := range trs {
+		v.WriteString(ntriple(tr) + "\n")
+	}
+	key, ms := redisKey(res), int64((ttl+c.cfg.Stale)/time.Millisecond)
+	// The sets of keys live as long as the longest lived description in
+	// them, found or not.
+	longest := c.cfg.TTL
+	if c.cfg.NotFoundTTL > longest {
+		longest = c.cfg.NotFoundTTL
+	}
+	setMS := int64((longest + c.cfg.Stale) / time.Millisecond)
+	conn := c.pool.Get()
+	defer conn.Close()
+	conn.Send("MULTI")
+	conn.Send("SET", key, v.String(), "PX", ms)
+	for _, set := range []string{redisPrefix + "uri:" + res.uri, redisPrefix + "graph:" + res.graph} {
+		conn.Send("SADD", set, key)
+		conn.Send("PEXPIRE", set, setMS)
+	}
+	if _, err := conn.Do("EXEC"); err != nil {
+		log.Printf("redis cache: %v", err)
+	}
+}
+
+func (c *redisCache) evictURIs(uris []string) (int, error) {
+	n := 0
+	for _, uri := range uris {
+		m, err := c.evictSet(redisPrefix + "uri:" + uri)
+		if err != nil {
+			return n, err
+		}
+		n += m
+	}
+	return n, nil
+}
+
+func (c *redisCache) evictGraph(graph string) (int, error) {
+	return c.evictSet(redisPrefix + "graph:" + graph)
+}
+
+// evictSet deletes the descriptions whose keys are in set, and the set.
+func (c *redisCache) evictSet(set string) (int, error) {
+	conn := c.pool.Get()
+	defer conn.Close()
+	keys, err := redis.Strings(conn.Do("SMEMBERS", set))
+	if err != nil || len(keys) == 0 {
+		return 0, err
+	}
+	args := redis.Args{}.AddFlat(keys)
+	n, err := redis.Int(conn.Do("DEL", args...))
+	if err != nil {
+		return 0, err
+	}
+	_, err = conn.Do("DEL", set)
+	return n, err
+}
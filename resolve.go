@@ -0,0 +1,208 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// A resolver resolves a request path to the resource it names, and how to
+// describe it. Custom resolvers can be used to implement other routing
+// logic than mapping URL prefixes to graphs.
+type resolver interface {
+	resolve(path string) (resolution, error)
+}
+
+// resolution is a resolved resource request.
+type resolution struct {
+	route
+	// uri is the URI of the resource.
+	uri string
+	// query is the graph query describing the resource.
+	query string
+}
+
+var (
+	errNoRoute    = errors.New("no graph is exposed at this path")
+	errInvalidIRI = errors.New("the path does not make a valid IRI")
+)
+
+// resolveStatus returns the status of requests for paths which failed to
+// resolve with err.
+func resolveStatus(err error) int {
+	if err == errInvalidIRI {
+		return http.StatusBadRequest
+	}
+	return http.StatusNotFound
+}
+
+// validIRI reports whether iri can be written as an IRI reference in a
+// query, i.e. it is valid UTF-8 without spaces, control characters or any
+// of <>"{}|^`\ which would end or break out of it.
+func validIRI(iri string) bool {
+	return utf8.ValidString(iri) && !strings.ContainsAny(iri, "<>\"{}|^`\\") &&
+		strings.IndexFunc(iri, func(r rune) bool { return r <= ' ' || unicode.IsControl(r) }) < 0
+}
+
+var rgxpDescribeMode = regexp.MustCompile(`^[A-Za-z+]+$`)
+
+// newResolver returns the resolver for the given config and routes.
+func newResolver(cfg config, routes []route) (resolver, error) {
+	if !rgxpDescribeMode.MatchString(cfg.DescribeMode) {
+		return nil, fmt.Errorf("invalid describe mode: %q", cfg.DescribeMode)
+	}
+	rr := routeResolver{routes: routes, describeMode: cfg.DescribeMode}
+	if cfg.Backend == backendSPARQL {
+		rr.describeMode = ""
+	}
+	for _, qc := range cfg.Queries {
+		t, err := newQueryTemplate(qc)
+		if err != nil {
+			return nil, err
+		}
+		rr.templates = append(rr.templates, t)
+	}
+	if len(cfg.Rewrites) == 0 {
+		return rr, nil
+	}
+	rw := rewriteResolver{next: rr}
+	for _, rc := range cfg.Rewrites {
+		pattern, err := regexp.Compile(rc.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("rewrite %q: %v", rc.Pattern, err)
+		}
+		rw.rewrites = append(rw.rewrites, rewrite{pattern: pattern, replacement: rc.Replacement})
+	}
+	return rw, nil
+}
+
+// route maps a URL prefix to the graph exposed under it, and the base
+// URI of the resources in that graph.
+type route struct {
+	prefix string
+	graph  string
+	base   string
+}
+
+// match reports whether the route serves path, returning the path
+// with the route prefix stripped.
+func (rt route) match(path string) (string, bool) {
+	if path == rt.prefix || strings.HasPrefix(path, rt.prefix+"/") {
+		return path[len(rt.prefix):], true
+	}
+	return "", false
+}
+
+// newRoutes returns the routes for the mounted graphs, ordered so that
+// the longest matching prefix wins. The default graph is served on
+// paths not matching any other prefix.
+func newRoutes(cfg config) []route {
+	base := strings.TrimSuffix(cfg.Base, "/")
+	routes := []route{{prefix: "", graph: cfg.Graph, base: base}}
+	for prefix, m := range cfg.Graphs {
+		rt := route{prefix: "/" + strings.Trim(prefix, "/"), graph: m.Graph, base: base}
+		if m.Base != "" {
+			rt.base = strings.TrimSuffix(m.Base, "/")
+		}
+		routes = append(routes, rt)
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		return len(routes[i].prefix) > len(routes[j].prefix)
+	})
+	return routes
+}
+
+// routeResolver resolves paths using the routes of the mounted graphs.
+type routeResolver struct {
+	routes []route
+	// describeMode is the Virtuoso describe mode, e.g. CBD or SCBD, or
+	// empty for standard DESCRIBE queries.
+	describeMode string
+	templates    []queryTemplate
+}
+
+func (rr routeResolver) resolve(path string) (resolution, error) {
+	for _, rt := range rr.routes {
+		if p, ok := rt.match(path); ok {
+			uri := rt.base + p
+			if !validIRI(uri) {
+				return resolution{}, errInvalidIRI
+			}
+			return resolution{route: rt, uri: uri, query: rr.buildQuery(uri, strings.TrimPrefix(p, "/"))}, nil
+		}
+	}
+	return resolution{}, errNoRoute
+}
+
+// uriPlaceholder is replaced with the resource URI in query templates.
+const uriPlaceholder = "{{uri}}"
+
+// queryTemplate is a custom query used for resources matching pattern.
+type queryTemplate struct {
+	pattern *regexp.Regexp
+	query   string
+}
+
+func newQueryTemplate(qc queryConfig) (queryTemplate, error) {
+	t := queryTemplate{query: qc.Query}
+	if qc.File != "" {
+		b, err := ioutil.ReadFile(qc.File)
+		if err != nil {
+			return t, err
+		}
+		t.query = string(b)
+	}
+	if !strings.Contains(t.query, uriPlaceholder) {
+		return t, fmt.Errorf("query for %q: missing %s placeholder", qc.Pattern, uriPlaceholder)
+	}
+	var err error
+	if t.pattern, err = regexp.Compile("^(?:" + qc.Pattern + ")"); err != nil {
+		return t, fmt.Errorf("query for %q: %v", qc.Pattern, err)
+	}
+	return t, nil
+}
+
+// buildQuery returns the query describing the resource with the given
+// URI. The first query template matching the URI relative to the base URI
+// is used, or else a DESCRIBE query.
+func (rr routeResolver) buildQuery(uri, rel string) string {
+	for _, t := range rr.templates {
+		if t.pattern.MatchString(rel) {
+			return strings.Replace(t.query, uriPlaceholder, "<"+uri+">", -1)
+		}
+	}
+	if rr.describeMode == "" {
+		return "DESCRIBE <" + uri + ">"
+	}
+	return fmt.Sprintf(descQuery, rr.describeMode, uri)
+}
+
+// rewrite replaces paths matching pattern.
+type rewrite struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// rewriteResolver rewrites paths before resolving them with next, e.g. to
+// map legacy identifiers to current URIs. Only the first matching rewrite
+// is applied.
+type rewriteResolver struct {
+	rewrites []rewrite
+	next     resolver
+}
+
+func (rw rewriteResolver) resolve(path string) (resolution, error) {
+	for _, r := range rw.rewrites {
+		if r.pattern.MatchString(path) {
+			path = r.pattern.ReplaceAllString(path, r.replacement)
+			break
+		}
+	}
+	return rw.next.resolve(path)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+)
+
+// retryTransport retries requests to the SPARQL endpoints failing with
+// transient errors, e.g. while Virtuoso is checkpointing, waiting
+// exponentially longer between attempts. All requests to the endpoints
+// are queries, so they can safely be sent again.
+type retryTransport struct {
+	next    http.RoundTripper
+	retries int
+	backoff time.Duration
+}
+
+// CloseIdleConnections closes the idle connections of the wrapped
+// transport.
+func (t retryTransport) CloseIdleConnections() {
+	closeIdleConnections(t.next)
+}
+
+func (t retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		r := req
+		if attempt > 0 && req.Body != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r = req.Clone(req.Context())
+			r.Body = body
+		}
+		resp, err := t.next.RoundTrip(r)
+		reason := transientError(resp, err)
+		if reason == "" || attempt == t.retries || req.Body != nil && req.GetBody == nil || req.Context().Err() != nil {
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<16))
+			resp.Body.Close()
+		}
+		// The wait is jittered, so that the requests failing together
+		// don't come back together.
+		d := t.backoff << uint(attempt)
+		d = d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+		log.Printf("%s: %s, retrying in %v", req.URL.Host, reason, d)
+		select {
+		case <-time.After(d):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+// transientError returns why the response resp or error err is worth
+// retrying, or an empty string if it is not. Timeouts are not retried,
+// as the endpoint has already been given its time.
+func transientError(resp *http.Response, err error) string {
+	if err != nil {
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			return ""
+		}
+		return err.Error()
+	}
+	switch resp.StatusCode {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return resp.Status
+	}
+	return ""
+}
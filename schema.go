@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/knakk/kbp/rdf"
+)
+
+const schemaOrgContext = "https://schema.org"
+
+// schemaMapping maps classes and properties to schema.org, with keys
+// expanded to full IRIs.
+type schemaMapping struct {
+	classes    map[string]string
+	properties map[string]string
+	// via lists properties of blank nodes whose value is used in place of
+	// the blank node, e.g. the agent of a contribution.
+	via []string
+}
+
+func newSchemaMapping(cfg schemaConfig, prefixes map[string]string) schemaMapping {
+	m := schemaMapping{
+		classes:    make(map[string]string, len(cfg.Classes)),
+		properties: make(map[string]string, len(cfg.Properties)),
+	}
+	for k, v := range cfg.Classes {
+		m.classes[expandIRI(k, prefixes)] = v
+	}
+	for k, v := range cfg.Properties {
+		m.properties[expandIRI(k, prefixes)] = v
+	}
+	for _, v := range cfg.Via {
+		m.via = append(m.via, expandIRI(v, prefixes))
+	}
+	return m
+}
+
+// expandIRI expands a prefixed name using the prefix table. Other
+// strings are returned unchanged.
+func expandIRI(s string, prefixes map[string]string) string {
+	if i := strings.Index(s, ":"); i > 0 {
+		if ns, ok := prefixes[s[:i]]; ok {
+			return ns + s[i+1:]
+		}
+	}
+	return s
+}
+
+// schemaOrg returns the description mapped to schema.org, as a JSON-LD
+// node object. It returns nil if the resource has no mapped type.
+func (srv server) schemaOrg(res resolution, trs []rdf.Triple) jsonldObject {
+	node := rdf.NewNamedNode(res.uri)
+	obj := jsonldObject{"@context": schemaOrgContext, "@id": res.uri}
+	values := make(map[string][]interface{})
+	for _, tr := range trs {
+		if tr.Subject != node {
+			continue
+		}
+		if tr.Predicate.Name() == rdfType {
+			if t, ok := tr.Object.(rdf.NamedNode); ok {
+				if typ, ok := srv.schema.classes[t.Name()]; ok {
+					values["@type"] = append(values["@type"], typ)
+				}
+			}
+			continue
+		}
+		prop, ok := srv.schema.properties[tr.Predicate.Name()]
+		if !ok {
+			continue
+		}
+		if v := srv.schemaValue(tr.Object, trs); v != nil {
+			values[prop] = append(values[prop], v)
+		}
+	}
+	if len(values["@type"]) == 0 {
+		return nil
+	}
+	for k, vs := range values {
+		if len(vs) == 1 {
+			obj[k] = vs[0]
+		} else {
+			obj[k] = vs
+		}
+	}
+	return obj
+}
+
+// schemaValue returns the schema.org value of an object node, or nil if it
+// cannot be mapped.
+func (srv server) schemaValue(node rdf.Node, trs []rdf.Triple) interface{} {
+	switch n := node.(type) {
+	case rdf.NamedNode:
+		return jsonldObject{"@id": n.Name()}
+	case rdf.Literal:
+		return n.ValueAsString()
+	case rdf.BlankNode:
+		for _, via := range srv.schema.via {
+			for _, tr := range trs {
+				if tr.Subject == node && tr.Predicate.Name() == via {
+					if _, ok := tr.Object.(rdf.BlankNode); !ok {
+						return srv.schemaValue(tr.Object, trs)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// schemaOrgScript returns a script element embedding the schema.org
+// description of the resource, or an empty string if it has none.
+func (srv server) schemaOrgScript(res resolution, trs []rdf.Triple) string {
+	obj := srv.schemaOrg(res, trs)
+	if obj == nil {
+		return ""
+	}
+	// json.Marshal escapes <, > and &, so the data cannot end the script.
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return ""
+	}
+	var buf bytes.Buffer
+	buf.WriteString(`<script type="application/ld+json">`)
+	buf.Write(b)
+	buf.WriteString(`</script>`)
+	return buf.String()
+}
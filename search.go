@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// searchPath is where the full-text search of labels is served.
+const searchPath = "/search"
+
+const searchQuery = `SELECT DISTINCT ?s ?label WHERE { ?s ?p ?label . ?label bif:contains '%s' FILTER (isIRI(?s)%s) } ORDER BY ?label ?s LIMIT %d OFFSET %d`
+
+// searchExpression returns the Virtuoso free-text expression matching
+// labels containing all the words of q, or an empty string if q has no
+// words. Words of four or more characters also match as prefixes.
+func searchExpression(q string) string {
+	words := strings.FieldsFunc(q, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, w := range words {
+		if utf8.RuneCountInString(w) >= 4 {
+			w += "*"
+		}
+		words[i] = `"` + w + `"`
+	}
+	return strings.Join(words, " AND ")
+}
+
+// serveSearch serves a page of the resources in the default graph with
+// labels matching the q parameter, using the label predicates if any are
+// configured. The page parameter selects the page of results.
+func (srv server) serveSearch(w http.ResponseWriter, r *http.Request) {
+	f, _ := formatByName("html")
+	rt := srv.routes[len(srv.routes)-1]
+	q, page := r.FormValue("q"), requestedPage(r)
+
+	var body bytes.Buffer
+	if expr := searchExpression(q); expr != "" {
+		var filter string
+		if len(srv.labels) > 0 {
+			filter = " && ?p IN (" + srv.labelPredicates() + ")"
+		}
+		// One more result than shown is asked for, to know whether there
+		// is a next page.
+		rows, err := selectRows(srv.reqContext(), srv.endpoints[0], rt.graph, fmt.Sprintf(searchQuery, expr, filter, srv.searchPageSize+1, (page-1)*srv.searchPageSize))
+		if err != nil {
+			srv.serveError(w, f, upstreamStatus(w, err, http.StatusInternalServerError), err.Error(), nil)
+			return
+		}
+		more := len(rows) > srv.searchPageSize
+		if more {
+			rows = rows[:srv.searchPageSize]
+		}
+		if len(rows) == 0 {
+			fmt.Fprintf(&body, "<p>No results for %s.</p>\n", html.EscapeString(q))
+		}
+		writeResourceList(&body, htmlStyle{srv: srv, rt: rt}, rows, (page-1)*srv.searchPageSize)
+		var prev, next string
+		if page > 1 {
+			prev = searchPageURL(q, page-1)
+		}
+		if more {
+			next = searchPageURL(q, page+1)
+		}
+		writePager(&body, prev, next)
+	}
+
+	w.Header().Set("Content-Type", f.contentType())
+	err := srv.writeHTMLPage(w, "search", htmlPage{
+		Title: "Search: " + q,
+		Body:  template.HTML(body.String()),
+		Query: q,
+	})
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// writeResourceList writes a list of the resources in the s column of
+// rows, with the values of the label column, numbered from offset+1.
+func writeResourceList(w io.Writer, s htmlStyle, rows []map[string]string, offset int) {
+	if len(rows) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "<ol start=\"%d\">\n", offset+1)
+	for _, row := range rows {
+		href, text := row["s"], row["s"]
+		if rel, ok := s.link(row["s"]); ok {
+			href, text = s.rt.prefix+"/"+rel, rel
+		}
+		fmt.Fprintf(w, "<li><a href=\"%s\">%s</a> <span class=\"label\">%s</span></li>\n",
+			escapeHref(href), html.EscapeString(text), html.EscapeString(row["label"]))
+	}
+	io.WriteString(w, "</ol>\n")
+}
+
+// writePager writes the links to the previous and next pages of a list,
+// where there are any.
+func writePager(w io.Writer, prev, next string) {
+	if prev != "" {
+		fmt.Fprintf(w, "<a rel=\"prev\" href=\"%s\">Previous</a>\n", html.EscapeString(prev))
+	}
+	if next != "" {
+		fmt.Fprintf(w, "<a rel=\"next\" href=\"%s\">Next</a>\n", html.EscapeString(next))
+	}
+}
+
+// requestedPage returns the page number given by the page parameter of
+// r, counting from 1.
+func requestedPage(r *http.Request) int {
+	page, err := strconv.Atoi(r.FormValue("page"))
+	if err != nil || page < 1 {
+		return 1
+	}
+	return page
+}
+
+// searchPageURL returns the URL of the given page of search results.
+func searchPageURL(q string, page int) string {
+	return searchPath + "?" + url.Values{"q": {q}, "page": {strconv.Itoa(page)}}.Encode()
+}
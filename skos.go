@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"io"
+
+	"github.com/knakk/kbp/rdf"
+)
+
+const (
+	skosConcept   = "http://www.w3.org/2004/02/skos/core#Concept"
+	skosPrefLabel = "http://www.w3.org/2004/02/skos/core#prefLabel"
+	skosBroader   = "http://www.w3.org/2004/02/skos/core#broader"
+	skosNarrower  = "http://www.w3.org/2004/02/skos/core#narrower"
+	skosRelated   = "http://www.w3.org/2004/02/skos/core#related"
+)
+
+// isConcept reports whether node is a skos:Concept.
+func isConcept(node rdf.Node, trs []rdf.Triple) bool {
+	for _, tr := range trs {
+		if tr.Subject == node && tr.Predicate.Name() == rdfType {
+			if t, ok := tr.Object.(rdf.NamedNode); ok && t.Name() == skosConcept {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isSKOSRelation(p rdf.NamedNode) bool {
+	switch p.Name() {
+	case skosBroader, skosNarrower, skosRelated:
+		return true
+	}
+	return false
+}
+
+// withoutSKOSRelations returns trs without the broader, narrower and
+// related concepts of node, which are rendered as a hierarchy instead.
+func withoutSKOSRelations(node rdf.Node, trs []rdf.Triple) []rdf.Triple {
+	var res []rdf.Triple
+	for _, tr := range trs {
+		if tr.Subject == node && isSKOSRelation(tr.Predicate) {
+			continue
+		}
+		res = append(res, tr)
+	}
+	return res
+}
+
+// writeSKOS writes the hierarchy of the concept node, with its broader
+// concepts above it and its narrower concepts below it, followed by the
+// related concepts. The links are annotated with RDFa.
+func writeSKOS(w io.Writer, s htmlStyle, node rdf.NamedNode, trs []rdf.Triple) {
+	rels := make(map[string][]rdf.NamedNode)
+	for _, tr := range trs {
+		if tr.Subject != node || !isSKOSRelation(tr.Predicate) {
+			continue
+		}
+		if o, ok := tr.Object.(rdf.NamedNode); ok {
+			rels[tr.Predicate.Name()] = append(rels[tr.Predicate.Name()], o)
+		}
+	}
+
+	fmt.Fprintf(w, "<nav about=\"%s\">\n<h2>Hierarchy</h2>\n<ul>\n", html.EscapeString(node.Name()))
+	if broader := rels[skosBroader]; len(broader) > 0 {
+		io.WriteString(w, "<li>")
+		for i, b := range broader {
+			if i > 0 {
+				io.WriteString(w, ", ")
+			}
+			io.WriteString(w, skosLink(s, skosBroader, b, trs))
+		}
+		io.WriteString(w, "\n<ul>\n")
+	}
+	fmt.Fprintf(w, "<li><strong>%s</strong>\n", html.EscapeString(conceptLabel(s, node, trs)))
+	if narrower := rels[skosNarrower]; len(narrower) > 0 {
+		io.WriteString(w, "<ul>\n")
+		for _, n := range narrower {
+			fmt.Fprintf(w, "<li>%s</li>\n", skosLink(s, skosNarrower, n, trs))
+		}
+		io.WriteString(w, "</ul>\n")
+	}
+	io.WriteString(w, "</li>\n")
+	if len(rels[skosBroader]) > 0 {
+		io.WriteString(w, "</ul>\n</li>\n")
+	}
+	io.WriteString(w, "</ul>\n")
+
+	if related := rels[skosRelated]; len(related) > 0 {
+		io.WriteString(w, "<h2>Related</h2>\n<ul>\n")
+		for _, r := range related {
+			fmt.Fprintf(w, "<li>%s</li>\n", skosLink(s, skosRelated, r, trs))
+		}
+		io.WriteString(w, "</ul>\n")
+	}
+	io.WriteString(w, "</nav>\n")
+}
+
+// skosLink returns a link to the concept c, as the object of p.
+func skosLink(s htmlStyle, p string, c rdf.NamedNode, trs []rdf.Triple) string {
+	href := c.Name()
+	if rel, ok := s.link(c.Name()); ok {
+		href = s.rt.prefix + "/" + rel
+	}
+	return fmt.Sprintf(`<a property="%s" resource="%s" href="%s">%s</a>`,
+		html.EscapeString(p), html.EscapeString(c.Name()), escapeHref(href), html.EscapeString(conceptLabel(s, c, trs)))
+}
+
+// conceptLabel returns the skos:prefLabel of the concept c, or else its
+// URI relative to the base URI.
+func conceptLabel(s htmlStyle, c rdf.NamedNode, trs []rdf.Triple) string {
+	for _, tr := range trs {
+		if tr.Subject == c && tr.Predicate.Name() == skosPrefLabel {
+			if l, ok := tr.Object.(rdf.Literal); ok {
+				return l.ValueAsString()
+			}
+		}
+	}
+	rel, _ := s.link(c.Name())
+	return rel
+}
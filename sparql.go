@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/knakk/kbp/rdf"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// allGraphs is the graph of routes exposing the union of all the graphs
+// of the endpoint.
+const allGraphs = "*"
+
+// defaultGraphs returns the graphs whose union is queried for graph: the
+// graph IRIs separated by whitespace, or none for allGraphs or no graph,
+// leaving the default graph to the endpoint. Virtuoso then queries all
+// its graphs.
+func defaultGraphs(graph string) []string {
+	if graph == allGraphs {
+		return nil
+	}
+	return strings.Fields(graph)
+}
+
+// queryTimeoutKey is the context key of the timeout of the queries sent
+// with the context.
+type queryTimeoutKey struct{}
+
+// withQueryTimeout returns a copy of ctx asking the endpoint to stop the
+// queries sent with it after d, so that expensive queries don't tie up
+// its threads. A d of 0 leaves it to the endpoint.
+func withQueryTimeout(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, queryTimeoutKey{}, d)
+}
+
+// query sends a SPARQL query to endpoint, asking for results in the given
+// format. It is canceled with ctx, and stopped by Virtuoso after the
+// timeout of ctx, if any. The parameters are sent form-encoded in the
+// body of a POST, so that long queries don't run into URL length limits.
+// The caller must close the response body.
+func query(ctx context.Context, endpoint, graph, q, format string) (*http.Response, error) {
+	params := url.Values{}
+	params.Set("query", q)
+	for _, g := range defaultGraphs(graph) {
+		params.Add("default-graph-uri", g)
+	}
+	params.Set("format", format)
+	timeout, _ := ctx.Value(queryTimeoutKey{}).(time.Duration)
+	if timeout > 0 {
+		params.Set("timeout", strconv.FormatInt(int64(timeout/time.Millisecond), 10))
+	}
+
+	req, err := http.NewRequest("POST", endpoint, strings.NewReader(params.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// Endpoints other than Virtuoso go by the Accept header.
+	req.Header.Set("Accept", format)
+	resp, err := upstreamClient().Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %s", endpoint, resp.Status)
+	}
+	// Virtuoso answers queries running into the timeout with the results
+	// found so far, which would make incomplete descriptions.
+	if resp.Header.Get("X-SQL-State") == "S1TAT" {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: query stopped after %v", endpoint, timeout)
+	}
+	if err := utf8Body(resp); err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %v", endpoint, err)
+	}
+	return resp, nil
+}
+
+// utf8Body transcodes the body of resp to UTF-8, if it declares another
+// charset. A body without a charset is assumed to be UTF-8, as all the
+// formats we ask for default to it.
+func utf8Body(resp *http.Response) error {
+	_, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		return nil
+	}
+	cs := strings.ToLower(params["charset"])
+	if cs == "" || cs == "utf-8" || cs == "utf8" {
+		return nil
+	}
+	enc, err := htmlindex.Get(cs)
+	if err != nil {
+		return fmt.Errorf("unsupported charset %q", cs)
+	}
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{enc.NewDecoder().Reader(resp.Body), resp.Body}
+	return nil
+}
+
+// ask sends an ASK query to endpoint and returns the answer.
+func ask(ctx context.Context, endpoint, graph, q string) (bool, error) {
+	resp, err := query(ctx, endpoint, graph, q, "application/sparql-results+json")
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	var res struct {
+		Boolean *bool `json:"boolean"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return false, fmt.Errorf("%s: %v", endpoint, err)
+	}
+	if res.Boolean == nil {
+		return false, fmt.Errorf("%s: not an ASK result", endpoint)
+	}
+	return *res.Boolean, nil
+}
+
+// queryLink returns the URL running the query describing the resource
+// against the endpoint of the query panel.
+func (srv server) queryLink(res resolution) string {
+	params := url.Values{}
+	params.Set("query", res.query)
+	for _, g := range defaultGraphs(res.graph) {
+		params.Add("default-graph-uri", g)
+	}
+	return srv.queryPanel.Endpoint + "?" + params.Encode()
+}
+
+// selectRows sends a SELECT query to endpoint, and returns the bound
+// values of each result row, keyed by variable name.
+func selectRows(ctx context.Context, endpoint, graph, q string) ([]map[string]string, error) {
+	resp, err := query(ctx, endpoint, graph, q, "application/sparql-results+json")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var res struct {
+		Results struct {
+			Bindings []map[string]struct {
+				Value string `json:"value"`
+			} `json:"bindings"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, fmt.Errorf("%s: %v", endpoint, err)
+	}
+	rows := make([]map[string]string, len(res.Results.Bindings))
+	for i, b := range res.Results.Bindings {
+		rows[i] = make(map[string]string, len(b))
+		for name, v := range b {
+			rows[i][name] = v.Value
+		}
+	}
+	return rows, nil
+}
+
+// check verifies that all endpoints, and the replicas, are reachable, and
+// that the exposed graphs exist and are not empty. The graphs of a union
+// are checked one by one, and a union of all graphs checks that the
+// endpoint has any data.
+func (srv server) check() error {
+	for _, endpoint := range append(append([]string(nil), srv.endpoints...), srv.replicas...) {
+		if _, err := ask(context.Background(), endpoint, "", "ASK {}"); err != nil {
+			return err
+		}
+		checked := make(map[string]bool)
+		for _, rt := range srv.routes {
+			graphs := defaultGraphs(rt.graph)
+			if len(graphs) == 0 {
+				graphs = []string{""}
+			}
+			for _, g := range graphs {
+				if checked[g] {
+					continue
+				}
+				checked[g] = true
+				ok, err := ask(context.Background(), endpoint, g, "ASK { ?s ?p ?o }")
+				if err != nil {
+					return err
+				}
+				if !ok {
+					return fmt.Errorf("%s: graph %q does not exist or is empty", endpoint, g)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// decodeTriples reads the triples from r, stopping after limit triples
+// if limit is not 0.
+func decodeTriples(r io.Reader, limit int) ([]rdf.Triple, error) {
+	var trs []rdf.Triple
+	dec := rdf.NewDecoder(r)
+	for tr, err := dec.Decode(); err != io.EOF; tr, err = dec.Decode() {
+		if err != nil {
+			return nil, err
+		}
+		trs = append(trs, tr)
+		if len(trs) == limit {
+			break
+		}
+	}
+	return trs, nil
+}
+
+// fetch sends a graph query to all configured endpoints, like
+// fetchTriples, with the context of the request served.
+func (srv server) fetch(graph, q string, limit int) ([]rdf.Triple, error) {
+	return fetchTriples(srv.reqContext(), srv.endpoints, graph, q, limit)
+}
+
+// fetchTriples sends a graph query to the endpoints concurrently, and
+// returns the merged triples of the results. Blank nodes are relabeled
+// per endpoint, so that they are not confused with each other. If limit
+// is not 0, no more than limit triples are read from each endpoint.
+func fetchTriples(ctx context.Context, endpoints []string, graph, q string, limit int) ([]rdf.Triple, error) {
+	results := make([][]rdf.Triple, len(endpoints))
+	errs := make([]error, len(endpoints))
+	var wg sync.WaitGroup
+	for i, endpoint := range endpoints {
+		wg.Add(1)
+		go func(i int, endpoint string) {
+			defer wg.Done()
+			resp, err := query(ctx, endpoint, graph, q, "text/plain")
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			defer resp.Body.Close()
+			results[i], errs[i] = decodeTriples(resp.Body, limit)
+		}(i, endpoint)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(results) == 1 {
+		return results[0], nil
+	}
+
+	var trs []rdf.Triple
+	seen := make(map[string]bool)
+	for i, res := range results {
+		for _, tr := range res {
+			if b, ok := tr.Subject.(rdf.BlankNode); ok {
+				tr.Subject = relabel(b, i)
+			}
+			if b, ok := tr.Object.(rdf.BlankNode); ok {
+				tr.Object = relabel(b, i)
+			}
+			key := ntriple(tr)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			trs = append(trs, tr)
+		}
+	}
+	return trs, nil
+}
+
+// relabel returns the blank node b scoped to the endpoint with index i.
+func relabel(b rdf.BlankNode, i int) rdf.BlankNode {
+	return rdf.NewBlankNode(fmt.Sprintf("e%d%s", i, strings.TrimPrefix(b.String(), "_:")))
+}
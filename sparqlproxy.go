@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sparqlPath is where read-only queries are passed on to the SPARQL
+// endpoint.
+const sparqlPath = "/sparql"
+
+var (
+	// rgxpQueryIgnored matches the parts of a query which can't hold
+	// keywords: comments, strings, IRIs, variables and prefixed names.
+	rgxpQueryIgnored = regexp.MustCompile(`(?s)#[^\n]*|"""(?:[^\\]|\\.)*?"""|'''(?:[^\\]|\\.)*?'''|"(?:[^"\\\n]|\\.)*"|'(?:[^'\\\n]|\\.)*'|<[^<>"{}|^` + "`" + `\\\s]*>|[?$]\w+|[\w-]*:[\w.-]*`)
+	rgxpQueryForm    = regexp.MustCompile(`(?i)^\s*(?:(?:BASE|PREFIX)\s+)*(SELECT|ASK|CONSTRUCT)\b`)
+	// rgxpQueryBlocked matches the keywords of updates, and of Virtuoso
+	// pragmas and federated queries, which are refused.
+	rgxpQueryBlocked = regexp.MustCompile(`(?i)\b(INSERT|DELETE|LOAD|CLEAR|CREATE|DROP|COPY|MOVE|ADD|DEFINE|SERVICE)\b`)
+	rgxpQueryLimit   = regexp.MustCompile(`(?i)\bLIMIT\s+(\d+)(?:\s+OFFSET\s+\d+)?\s*$|\bOFFSET\s+\d+\s+LIMIT\s+(\d+)\s*$`)
+)
+
+// checkQuery checks that q is a SELECT, ASK or CONSTRUCT query without
+// update keywords, and returns it with the result limit enforced: queries
+// without a LIMIT of their own get one, and queries asking for more
+// results than limit are refused.
+func checkQuery(q string, limit int) (string, error) {
+	stripped := rgxpQueryIgnored.ReplaceAllString(q, " ")
+	m := rgxpQueryForm.FindStringSubmatch(stripped)
+	if m == nil {
+		return "", fmt.Errorf("only SELECT, ASK and CONSTRUCT queries are allowed")
+	}
+	if kw := rgxpQueryBlocked.FindString(stripped); kw != "" {
+		return "", fmt.Errorf("%s is not allowed", strings.ToUpper(kw))
+	}
+	if strings.EqualFold(m[1], "ASK") || limit == 0 {
+		return q, nil
+	}
+	lm := rgxpQueryLimit.FindStringSubmatch(stripped)
+	if lm == nil {
+		// The newline ends a trailing comment.
+		return q + "\nLIMIT " + strconv.Itoa(limit), nil
+	}
+	n, err := strconv.Atoi(lm[1] + lm[2])
+	if err != nil || n > limit {
+		return "", fmt.Errorf("LIMIT %s exceeds the maximum of %d results", lm[1]+lm[2], limit)
+	}
+	return q, nil
+}
+
+// serveSPARQL passes read-only queries on to the first endpoint, with the
+// configured timeout and result limit, and returns the results as they
+// are. Queries are given by the query parameter, or as the body of a POST
+// with the application/sparql-query content type. The default graph can
+// be any of the exposed graphs, and is the default one unless given.
+func (srv server) serveSPARQL(w http.ResponseWriter, r *http.Request) {
+	var q string
+	switch r.Method {
+	case "GET", "HEAD":
+		q = r.URL.Query().Get("query")
+	case "POST":
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/sparql-query") {
+			b, err := ioutil.ReadAll(io.LimitReader(r.Body, 1<<20))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			q = string(b)
+		} else {
+			q = r.FormValue("query")
+		}
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if q == "" {
+		http.Error(w, "missing query", http.StatusBadRequest)
+		return
+	}
+	q, err := checkQuery(q, srv.sparql.Limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	graph := srv.routes[len(srv.routes)-1].graph
+	if g := r.FormValue("default-graph-uri"); g != "" {
+		exposed := false
+		for _, rt := range srv.routes {
+			exposed = exposed || rt.graph == allGraphs
+			for _, rg := range defaultGraphs(rt.graph) {
+				exposed = exposed || rg == g
+			}
+		}
+		if !exposed {
+			http.Error(w, fmt.Sprintf("graph %q is not exposed", g), http.StatusForbidden)
+			return
+		}
+		graph = g
+	}
+
+	params := url.Values{}
+	params.Set("query", q)
+	for _, g := range defaultGraphs(graph) {
+		params.Add("default-graph-uri", g)
+	}
+	// Virtuoso stops queries running longer than the timeout, in
+	// milliseconds, on its own, and the client gives up shortly after.
+	params.Set("timeout", strconv.FormatInt(int64(srv.sparql.Timeout/time.Millisecond), 10))
+	req, err := http.NewRequest("POST", srv.endpoints[0], strings.NewReader(params.Encode()))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if accept := r.Header.Get("Accept"); accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	// The queries of clients go through the retries and circuit breaker
+	// of the endpoints, so that a flood of failing queries opens it
+	// before it takes down the resource pages too.
+	client := &http.Client{Transport: upstreamClient().Transport, Timeout: srv.sparql.Timeout + 5*time.Second}
+	resp, err := client.Do(req.WithContext(r.Context()))
+	if err != nil {
+		http.Error(w, err.Error(), upstreamStatus(w, err, http.StatusBadGateway))
+		return
+	}
+	defer resp.Body.Close()
+	w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
+	w.WriteHeader(resp.StatusCode)
+	if r.Method != "HEAD" {
+		io.Copy(w, resp.Body)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import "testing"
+
+func TestCheckQuery(t *testing.T) {
+	tests := []struct {
+		q     string
+		limit int
+		want  string // the query passed on, or "" if it is refused
+	}{
+		{"SELECT * WHERE { ?s ?p ?o }", 100,
+			"SELECT * WHERE { ?s ?p ?o }\nLIMIT 100"},
+		{"select * where { ?s ?p ?o } limit 10", 100,
+			"select * where { ?s ?p ?o } limit 10"},
+		{"SELECT * WHERE { ?s ?p ?o } OFFSET 20 LIMIT 100", 100,
+			"SELECT * WHERE { ?s ?p ?o } OFFSET 20 LIMIT 100"},
+		{"SELECT * WHERE { ?s ?p ?o } LIMIT 1000", 100, ""},
+		{"SELECT * WHERE { ?s ?p ?o } LIMIT 1000", 0,
+			"SELECT * WHERE { ?s ?p ?o } LIMIT 1000"},
+		{"ASK { ?s ?p ?o }", 100, "ASK { ?s ?p ?o }"},
+		{"CONSTRUCT WHERE { ?s ?p ?o }", 100,
+			"CONSTRUCT WHERE { ?s ?p ?o }\nLIMIT 100"},
+		{"DESCRIBE <http://data.deichman.no/work/w1>", 100, ""},
+
+		// Keywords in comments, strings, IRIs, variables and prefixed
+		// names don't count.
+		{"# INSERT DATA { <a> <b> <c> }\nSELECT * WHERE { ?s ?p ?o } # LIMIT 5", 100,
+			"# INSERT DATA { <a> <b> <c> }\nSELECT * WHERE { ?s ?p ?o } # LIMIT 5\nLIMIT 100"},
+		{`SELECT * WHERE { ?s ?p "DELETE" , 'LIMIT 5' , """CLEAR""" }`, 100,
+			`SELECT * WHERE { ?s ?p "DELETE" , 'LIMIT 5' , """CLEAR""" }` + "\nLIMIT 100"},
+		{"SELECT ?insert WHERE { ?insert <http://example.org/drop> $load }", 100,
+			"SELECT ?insert WHERE { ?insert <http://example.org/drop> $load }\nLIMIT 100"},
+		{"PREFIX delete: <http://example.org/>\nSELECT * WHERE { ?s delete:insert ?o ; delete:limit 5 }", 100,
+			"PREFIX delete: <http://example.org/>\nSELECT * WHERE { ?s delete:insert ?o ; delete:limit 5 }\nLIMIT 100"},
+		{"BASE <http://data.deichman.no/>\nPREFIX : <http://data.deichman.no/ontology#>\nSELECT * WHERE { ?s :add ?o } LIMIT 5", 100,
+			"BASE <http://data.deichman.no/>\nPREFIX : <http://data.deichman.no/ontology#>\nSELECT * WHERE { ?s :add ?o } LIMIT 5"},
+
+		// Updates, wherever they are.
+		{"PREFIX ex: <http://example.org/>\nINSERT\n  DATA\n{ ex:a ex:b ex:c }", 100, ""},
+		{"SELECT * WHERE { ?s ?p ?o } ;\nINSERT\nDATA\n{ <a> <b> <c> }", 100, ""},
+		{"SELECT * WHERE { ?s ?p ?o } ;\n\tdelete\n\twhere { ?s ?p ?o }", 0, ""},
+		{"SELECT * WHERE { SERVICE <http://example.org/sparql> { ?s ?p ?o } }", 100, ""},
+		{"DEFINE input:inference 'x'\nSELECT * WHERE { ?s ?p ?o }", 100, ""},
+
+		// The LIMIT of a subquery is not that of the query.
+		{"SELECT * WHERE { { SELECT ?s WHERE { ?s ?p ?o } LIMIT 5 } ?s ?q ?v }", 100,
+			"SELECT * WHERE { { SELECT ?s WHERE { ?s ?p ?o } LIMIT 5 } ?s ?q ?v }\nLIMIT 100"},
+		{"SELECT * WHERE { { SELECT ?s WHERE { ?s ?p ?o } LIMIT 5000 } }", 100,
+			"SELECT * WHERE { { SELECT ?s WHERE { ?s ?p ?o } LIMIT 5000 } }\nLIMIT 100"},
+		{"SELECT * WHERE { { SELECT ?s WHERE { ?s ?p ?o } LIMIT 5 } } LIMIT 5000", 100, ""},
+		{"SELECT * WHERE { { SELECT ?s WHERE { ?s ?p ?o } LIMIT 5000 } } LIMIT 50", 100,
+			"SELECT * WHERE { { SELECT ?s WHERE { ?s ?p ?o } LIMIT 5000 } } LIMIT 50"},
+	}
+	for _, test := range tests {
+		got, err := checkQuery(test.q, test.limit)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("checkQuery(%q, %d) = %q, want it refused", test.q, test.limit, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("checkQuery(%q, %d): %v", test.q, test.limit, err)
+		} else if got != test.want {
+			t.Errorf("checkQuery(%q, %d) = %q, want %q", test.q, test.limit, got, test.want)
+		}
+	}
+}
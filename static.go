@@ -0,0 +1,431 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// staticPath is where the static assets of the HTML views are served.
+const staticPath = "/static/"
+
+// stylesheetName and scriptName are the stylesheet and script linked to
+// from the HTML pages.
+const (
+	stylesheetName = "vindu.css"
+	scriptName     = "vindu.js"
+)
+
+// vizScriptName and queryScriptName are the scripts of the neighborhood
+// diagrams and the query editor.
+const (
+	vizScriptName   = "viz.js"
+	queryScriptName = "query.js"
+)
+
+// defaultStylesheet is served as the stylesheet unless the static
+// directory has one. The Turtle view keeps its preformatted layout, but
+// wraps long lines on narrow screens. It follows the dark mode of the
+// browser, and prints the descriptions unfolded and without navigation.
+const defaultStylesheet = `body{margin:0;font:16px/1.5 sans-serif;color:#383a42;background:#fff}
+main{max-width:72em;margin:0 auto;padding:0 1em}
+header{display:flex;align-items:center;gap:1em;padding:.5em 1em;background:#f0f0f1;border-bottom:1px solid #e0e0e0}
+header .brand{font-weight:bold;white-space:nowrap}
+header .brand img{display:block;max-height:2em}
+header form{display:flex;flex:1;max-width:72em;margin:0 auto}
+footer{max-width:72em;margin:2em auto 0;padding:1em;border-top:1px solid #e0e0e0;font-size:.9em;color:#696c77}
+header input[type=search]{flex:1;min-width:0;padding:.3em;font-size:1em}
+pre{font:.9em/1.4 monospace;overflow-x:auto;padding:1em 0}
+a{color:#4078f2;text-decoration:none}
+a:hover{text-decoration:underline}
+nav.formats{padding:.5em 0;font-size:.9em}
+nav.formats a{margin-left:.5em}
+nav.breadcrumbs{padding:.5em 0;border-bottom:1px solid #e0e0e0}
+h1,h2{font-weight:normal}
+pre .lang{font-size:.75em;padding:0 .3em;margin-left:.2em;border-radius:.3em;background:#f0f0f1}
+p.languages{font-size:.9em}
+p.truncated{padding:.5em;border-left:.3em solid #e0a800;background:#fff8e1}
+nav.contents{padding:.5em 0;font-size:.9em}
+nav.contents ul{columns:3 16em;margin:.5em 0}
+a.anchor{color:inherit}
+:target{background:#fff3c4}
+table.sortable{border-collapse:collapse;width:100%}
+table.sortable th{text-align:left;cursor:pointer;border-bottom:2px solid #e0e0e0}
+table.sortable th[aria-sort=ascending]::after{content:" \25b4"}
+table.sortable th[aria-sort=descending]::after{content:" \25be"}
+table.sortable td{padding:.2em .5em .2em 0;border-bottom:1px solid #e0e0e0}
+.editor{position:relative;font:.9em/1.4 monospace}
+.editor pre,.editor textarea{box-sizing:border-box;width:100%;min-height:20em;margin:0;padding:.5em;border:1px solid #e0e0e0;font:inherit;white-space:pre-wrap;overflow-wrap:break-word}
+.editor pre{position:absolute;top:0;left:0;height:100%;overflow:hidden;pointer-events:none}
+.editor textarea{position:relative;display:block;color:transparent;background:transparent;caret-color:#383a42;resize:vertical}
+.editor .var{color:#e45649}.editor .cm{color:#a0a1a7;font-style:italic}
+table.results{border-collapse:collapse;font-size:.9em}
+table.results th,table.results td{text-align:left;vertical-align:top;padding:.2em .5em;border-bottom:1px solid #e0e0e0}
+table.diff{border-collapse:collapse;width:100%;font:.9em/1.4 monospace}
+table.diff th,table.diff td{text-align:left;vertical-align:top;padding:.2em .5em;border-bottom:1px solid #e0e0e0;word-break:break-word}
+table.diff tr.added th{background:#e6ffec}
+table.diff tr.removed th{background:#ffebe9}
+table.diff tr.changed th{background:#fff3c4}
+ins{background:#e6ffec;text-decoration:none}
+del{background:#ffebe9}
+details.sparql pre{white-space:pre-wrap;word-break:break-all;background:#f0f0f1;padding:.5em}
+section.permalink input{width:100%;max-width:40em;font:.9em monospace}
+img.qr{display:block;width:8em;margin-top:.5em;image-rendering:pixelated}
+svg#viz{display:block;width:100%;height:70vh;border:1px solid #e0e0e0}
+svg#viz text{fill:currentColor;font-size:12px}
+svg#viz line{stroke:#a0a1a7}
+svg#viz .link-label{fill:#a0a1a7;font-size:10px}
+img.thumb{max-width:8em;max-height:8em;vertical-align:top}
+.preview{position:relative;cursor:help}
+.preview-card{position:absolute;left:0;top:1.4em;z-index:1;padding:.3em .6em;background:#fff;border:1px solid #e0e0e0;box-shadow:0 2px 6px rgba(0,0,0,.15);font-family:sans-serif;white-space:nowrap}
+.plabel{color:#0184bc;font-family:sans-serif}
+@media (max-width:40em){body{font-size:14px}main{padding:0 .5em}pre{white-space:pre-wrap;word-break:break-word}}
+@media (min-width:120em){body{font-size:20px}}
+.fold.folded:not(.long){display:none}
+.long.folded{display:inline-block;max-width:40em;overflow:hidden;text-overflow:ellipsis;white-space:nowrap;vertical-align:bottom}
+.fold-toggle{font:inherit;font-size:.8em;line-height:1;padding:0 .3em;margin:0 .2em;cursor:pointer}
+` + highlightCSS + `@media (prefers-color-scheme:dark){
+body{color:#abb2bf;background:#282c34}
+header{background:#21252b;border-color:#3e4451}
+footer{border-color:#3e4451;color:#7f848e}
+:target{background:#3e4451}
+pre .lang,details.sparql pre{background:#3e4451}
+.editor textarea{caret-color:#abb2bf}
+table.diff tr.added th,ins{background:#1e3a28}
+table.diff tr.removed th,del{background:#4a2126}
+table.diff tr.changed th{background:#3e4451}
+nav.breadcrumbs{border-color:#3e4451}
+p.truncated{background:#3a3320}
+a{color:#61afef}
+.kw{color:#c678dd}.iri{color:#61afef}.pn{color:#56b6c2}.bn{color:#d19a66}.lit{color:#98c379}.lang,.dt{color:#e5c07b}.label{color:#7f848e}.plabel{color:#56b6c2}
+.preview-card{background:#21252b;border-color:#3e4451}
+}
+@media print{
+body{color:#000;background:#fff;font-size:11pt}
+header,nav.formats,nav.contents,.views,p.languages,details.sparql,.fold-toggle,.preview-card,button.copy{display:none}
+main{max-width:none;padding:0}
+pre{white-space:pre-wrap;word-break:break-word;overflow:visible}
+.fold.folded:not(.long){display:inline}
+.long.folded{display:inline;white-space:pre-wrap}
+a{color:#000}
+}
+`
+
+// defaultScript adds buttons folding and unfolding the nested blank nodes
+// and long literals of the Turtle view. Blank nodes nested within others,
+// long literals and object lists shown as tables start out folded. It
+// also sorts the value tables by the clicked column, copies permalinks,
+// and shows the hover cards of external resources.
+const defaultScript = `document.addEventListener("DOMContentLoaded", function () {
+  document.querySelectorAll(".fold").forEach(function (el) {
+    var button = document.createElement("button");
+    button.type = "button";
+    button.className = "fold-toggle";
+    var fold = function (folded) {
+      el.classList.toggle("folded", folded);
+      button.textContent = folded ? "+" : "\u2212";
+      button.setAttribute("aria-expanded", String(!folded));
+    };
+    var nested = el.parentElement && el.parentElement.closest(".fold");
+    fold(el.classList.contains("long") || el.classList.contains("list") || nested !== null);
+    button.addEventListener("click", function () {
+      fold(!el.classList.contains("folded"));
+    });
+    el.parentNode.insertBefore(button, el);
+  });
+  document.querySelectorAll("table.sortable th").forEach(function (th) {
+    th.addEventListener("click", function () {
+      var tbody = th.closest("table").tBodies[0];
+      var col = th.cellIndex;
+      var asc = th.getAttribute("aria-sort") !== "ascending";
+      th.closest("tr").querySelectorAll("th").forEach(function (other) {
+        other.removeAttribute("aria-sort");
+      });
+      th.setAttribute("aria-sort", asc ? "ascending" : "descending");
+      Array.prototype.slice.call(tbody.rows).sort(function (a, b) {
+        var cmp = a.cells[col].textContent.localeCompare(b.cells[col].textContent, undefined, {numeric: true});
+        return asc ? cmp : -cmp;
+      }).forEach(function (row) {
+        tbody.appendChild(row);
+      });
+    });
+  });
+  document.querySelectorAll("button.copy").forEach(function (button) {
+    button.addEventListener("click", function () {
+      navigator.clipboard.writeText(button.dataset.copy).then(function () {
+        button.textContent = "Copied";
+      });
+    });
+  });
+  document.querySelectorAll(".preview").forEach(function (el) {
+    var card;
+    el.addEventListener("mouseenter", function () {
+      if (card) {
+        card.hidden = false;
+        return;
+      }
+      card = document.createElement("span");
+      card.className = "preview-card";
+      card.textContent = "\u2026";
+      el.appendChild(card);
+      fetch(el.dataset.preview).then(function (resp) {
+        return resp.ok ? resp.json() : {};
+      }).then(function (res) {
+        card.textContent = res.label || "No label";
+      }, function () {
+        card.textContent = "No label";
+      });
+    });
+    el.addEventListener("mouseleave", function () {
+      if (card) {
+        card.hidden = true;
+      }
+    });
+  });
+});
+`
+
+// vizScript draws the neighborhood diagram of the viz page, from the
+// nodes and links served at its data-graph URL. The nodes are laid out by
+// a simple force simulation, with the resource itself in the center, and
+// colored by their group.
+const vizScript = `document.addEventListener("DOMContentLoaded", function () {
+  var svg = document.getElementById("viz");
+  if (!svg) {
+    return;
+  }
+  var ns = "http://www.w3.org/2000/svg";
+  var width = svg.clientWidth || 800;
+  var height = svg.clientHeight || 600;
+  var element = function (name, attrs, parent) {
+    var el = document.createElementNS(ns, name);
+    Object.keys(attrs).forEach(function (k) {
+      el.setAttribute(k, attrs[k]);
+    });
+    parent.appendChild(el);
+    return el;
+  };
+  var hue = function (group) {
+    var h = 0;
+    for (var i = 0; i < group.length; i++) {
+      h = (h * 31 + group.charCodeAt(i)) % 360;
+    }
+    return h;
+  };
+  fetch(svg.dataset.graph).then(function (resp) {
+    if (!resp.ok) {
+      throw new Error(resp.statusText);
+    }
+    return resp.json();
+  }).then(function (graph) {
+    var nodes = graph.nodes;
+    var byId = {};
+    nodes.forEach(function (n, i) {
+      var a = 2 * Math.PI * i / nodes.length;
+      n.x = width / 2 + (i ? width / 3 * Math.cos(a) : 0);
+      n.y = height / 2 + (i ? height / 3 * Math.sin(a) : 0);
+      byId[n.id] = n;
+    });
+    var links = graph.links.map(function (l) {
+      return {source: byId[l.source], target: byId[l.target], label: l.label};
+    });
+    for (var step = 0; step < 300; step++) {
+      var max = 20 * (1 - step / 300);
+      nodes.forEach(function (a) {
+        a.dx = 0;
+        a.dy = 0;
+        nodes.forEach(function (b) {
+          var x = a.x - b.x, y = a.y - b.y, d2 = x * x + y * y || 1;
+          if (a !== b) {
+            a.dx += 5000 * x / d2;
+            a.dy += 5000 * y / d2;
+          }
+        });
+      });
+      links.forEach(function (l) {
+        var x = l.target.x - l.source.x, y = l.target.y - l.source.y;
+        var d = Math.sqrt(x * x + y * y) || 1, f = 0.05 * (d - 150) / d;
+        l.source.dx += x * f;
+        l.source.dy += y * f;
+        l.target.dx -= x * f;
+        l.target.dy -= y * f;
+      });
+      nodes.forEach(function (n, i) {
+        if (i > 0) {
+          n.x = Math.max(40, Math.min(width - 40, n.x + Math.max(-max, Math.min(max, n.dx))));
+          n.y = Math.max(20, Math.min(height - 20, n.y + Math.max(-max, Math.min(max, n.dy))));
+        }
+      });
+    }
+    links.forEach(function (l) {
+      var line = element("line", {x1: l.source.x, y1: l.source.y, x2: l.target.x, y2: l.target.y}, svg);
+      element("title", {}, line).textContent = l.label;
+      element("text", {x: (l.source.x + l.target.x) / 2, y: (l.source.y + l.target.y) / 2, "class": "link-label", "text-anchor": "middle"}, svg).textContent = l.label;
+    });
+    nodes.forEach(function (n, i) {
+      var parent = n.href ? element("a", {href: n.href}, svg) : svg;
+      var circle = element("circle", {cx: n.x, cy: n.y, r: i ? 8 : 12, fill: n.group ? "hsl(" + hue(n.group) + ",60%,55%)" : "#a0a1a7"}, parent);
+      element("title", {}, circle).textContent = n.id;
+      element("text", {x: n.x + 14, y: n.y + 4}, parent).textContent = n.label;
+    });
+  }).catch(function (err) {
+    element("text", {x: 10, y: 20}, svg).textContent = "Could not load the graph: " + err.message;
+  });
+});
+`
+
+// queryScript highlights the query of the query editor, and runs it
+// against the SPARQL endpoint, showing the results of SELECT queries as a
+// table, the answer of ASK queries, and the triples of CONSTRUCT queries
+// as Turtle. The query run is kept in the URL of the page, for sharing.
+const queryScript = `document.addEventListener("DOMContentLoaded", function () {
+  var form = document.querySelector("form.query-editor");
+  if (!form) {
+    return;
+  }
+  var textarea = form.querySelector("textarea");
+  var pre = form.querySelector(".editor pre");
+  var status = form.querySelector(".status");
+  var results = document.getElementById("results");
+  var token = /(#[^\n]*)|("(?:[^"\\\n]|\\.)*"|'(?:[^'\\\n]|\\.)*')|(<[^<>"\s]*>)|([?$]\w+)|\b(BASE|PREFIX|SELECT|ASK|CONSTRUCT|DESCRIBE|WHERE|FROM|NAMED|GRAPH|OPTIONAL|UNION|MINUS|FILTER|BIND|VALUES|AS|DISTINCT|REDUCED|ORDER|GROUP|BY|HAVING|ASC|DESC|LIMIT|OFFSET|NOT|EXISTS|IN)\b|([\w-]*:[\w.-]*)/gi;
+  var classes = ["cm", "lit", "iri", "var", "kw", "pn"];
+  var escape = function (s) {
+    return s.replace(/&/g, "&amp;").replace(/</g, "&lt;").replace(/>/g, "&gt;");
+  };
+  var highlight = function () {
+    var text = textarea.value;
+    var out = "";
+    var last = 0;
+    var m;
+    token.lastIndex = 0;
+    while ((m = token.exec(text)) !== null) {
+      var i = 1;
+      while (m[i] === undefined) {
+        i++;
+      }
+      out += escape(text.slice(last, m.index)) + '<span class="' + classes[i - 1] + '">' + escape(m[0]) + "</span>";
+      last = token.lastIndex;
+    }
+    pre.innerHTML = out + escape(text.slice(last)) + "\n";
+    pre.scrollTop = textarea.scrollTop;
+  };
+  var cell = function (row, value) {
+    var td = row.insertCell();
+    if (!value) {
+      return;
+    }
+    if (value.type === "uri") {
+      var a = document.createElement("a");
+      a.href = value.value;
+      a.textContent = value.value;
+      td.appendChild(a);
+    } else {
+      td.textContent = value.value;
+      if (value["xml:lang"]) {
+        var lang = document.createElement("span");
+        lang.className = "lang";
+        lang.textContent = "@" + value["xml:lang"];
+        td.appendChild(lang);
+      }
+    }
+  };
+  var show = function (text, construct) {
+    results.textContent = "";
+    if (construct) {
+      var turtle = document.createElement("pre");
+      turtle.textContent = text;
+      results.appendChild(turtle);
+      return "";
+    }
+    var res = JSON.parse(text);
+    if (typeof res.boolean === "boolean") {
+      results.textContent = String(res.boolean);
+      return "";
+    }
+    var table = document.createElement("table");
+    table.className = "results";
+    var head = table.createTHead().insertRow();
+    res.head.vars.forEach(function (v) {
+      var th = document.createElement("th");
+      th.textContent = "?" + v;
+      head.appendChild(th);
+    });
+    var body = table.createTBody();
+    res.results.bindings.forEach(function (b) {
+      var row = body.insertRow();
+      res.head.vars.forEach(function (v) {
+        cell(row, b[v]);
+      });
+    });
+    results.appendChild(table);
+    return res.results.bindings.length + " results, ";
+  };
+  textarea.addEventListener("input", highlight);
+  textarea.addEventListener("scroll", function () {
+    pre.scrollTop = textarea.scrollTop;
+  });
+  highlight();
+  form.addEventListener("submit", function (e) {
+    e.preventDefault();
+    var q = textarea.value;
+    var construct = /^[^{]*\bCONSTRUCT\b/i.test(q);
+    var start = Date.now();
+    status.textContent = "Running\u2026";
+    history.replaceState(null, "", "?query=" + encodeURIComponent(q));
+    fetch(form.action, {
+      method: "POST",
+      headers: {
+        "Content-Type": "application/sparql-query",
+        "Accept": construct ? "text/turtle" : "application/sparql-results+json"
+      },
+      body: q
+    }).then(function (resp) {
+      return resp.text().then(function (text) {
+        if (!resp.ok) {
+          throw new Error(text || resp.statusText);
+        }
+        return text;
+      });
+    }).then(function (text) {
+      status.textContent = show(text, construct) + (Date.now() - start) + " ms";
+    }).catch(function (err) {
+      results.textContent = "";
+      status.textContent = err.message;
+    });
+  });
+});
+`
+
+// builtinAssets are the static assets served unless the static directory
+// has files with the same names.
+var builtinAssets = map[string]struct {
+	contentType string
+	content     string
+}{
+	stylesheetName:  {"text/css; charset=utf-8", defaultStylesheet},
+	scriptName:      {"application/javascript; charset=utf-8", defaultScript},
+	vizScriptName:   {"application/javascript; charset=utf-8", vizScript},
+	queryScriptName: {"application/javascript; charset=utf-8", queryScript},
+}
+
+// serveStatic serves the static assets from the static directory, if
+// any, falling back to the built-in assets.
+func (srv server) serveStatic(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, staticPath)
+	if srv.staticDir != "" {
+		if f, err := http.Dir(srv.staticDir).Open("/" + name); err == nil {
+			defer f.Close()
+			if fi, err := f.Stat(); err == nil && !fi.IsDir() {
+				http.ServeContent(w, r, fi.Name(), fi.ModTime(), f)
+				return
+			}
+		}
+	}
+	asset, ok := builtinAssets[name]
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", asset.contentType)
+	http.ServeContent(w, r, name, time.Time{}, strings.NewReader(asset.content))
+}
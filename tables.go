@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/knakk/kbp/rdf"
+)
+
+const tableValueQuery = `SELECT ?s ?p ?o WHERE { VALUES ?s { %s } ?s ?p ?o FILTER (?p IN (%s)) }`
+
+// valueTable is a predicate of the described resource with so many values
+// that they are also shown as a table.
+type valueTable struct {
+	id   string
+	pred rdf.NamedNode
+	// rows are the values, in the order they are described.
+	rows []rdf.NamedNode
+	// written counts the values written to the description, so that the
+	// object list can be wrapped in a foldable element.
+	written int
+}
+
+// valueTables returns the tables of the predicates of node with at least
+// the configured number of values, in the order of the predicates. Only
+// predicates whose values are all named nodes, and which are used by no
+// other subject, get a table.
+func (srv server) valueTables(node rdf.NamedNode, trs []rdf.Triple) []*valueTable {
+	if srv.tables.Threshold == 0 {
+		return nil
+	}
+	var preds []string
+	found := make(map[string]*valueTable)
+	excluded := make(map[string]bool)
+	for _, tr := range trs {
+		p := tr.Predicate.Name()
+		o, ok := tr.Object.(rdf.NamedNode)
+		if tr.Subject != node || !ok {
+			excluded[p] = true
+			continue
+		}
+		t, ok := found[p]
+		if !ok {
+			t = &valueTable{pred: tr.Predicate}
+			found[p] = t
+			preds = append(preds, p)
+		}
+		t.rows = append(t.rows, o)
+	}
+	var tables []*valueTable
+	for _, p := range preds {
+		if t := found[p]; !excluded[p] && len(t.rows) >= srv.tables.Threshold {
+			t.id = fmt.Sprintf("table-%d", len(tables)+1)
+			tables = append(tables, t)
+		}
+	}
+	return tables
+}
+
+// wrap wraps the object list of the table in a foldable element, given
+// the rendering s of the next of its objects.
+func (t *valueTable) wrap(s string) string {
+	t.written++
+	if t.written == 1 {
+		s = fmt.Sprintf(`<span class="fold list" data-table="%s">`, t.id) + s
+	}
+	if t.written == len(t.rows) {
+		s += "</span>"
+	}
+	return s
+}
+
+// tableValues looks up the values of the table columns of the resources
+// iris in graph, keyed by resource and predicate. Failing lookups are
+// logged, and the values left out.
+func (srv server) tableValues(graph string, iris []string) map[string]map[string][]string {
+	values := make(map[string]map[string][]string)
+	if len(srv.tables.Columns) == 0 {
+		return values
+	}
+	preds := make([]string, len(srv.tables.Columns))
+	for i, c := range srv.tables.Columns {
+		preds[i] = "<" + c.Predicate + ">"
+	}
+	for len(iris) > 0 {
+		n := len(iris)
+		if n > labelBatch {
+			n = labelBatch
+		}
+		// IRIs from the data which can't be written in a query are
+		// left out.
+		var refs []string
+		for _, iri := range iris[:n] {
+			if validIRI(iri) {
+				refs = append(refs, "<"+iri+">")
+			}
+		}
+		iris = iris[n:]
+		if len(refs) == 0 {
+			continue
+		}
+		rows, err := selectRows(srv.reqContext(), srv.endpoints[0], graph, fmt.Sprintf(tableValueQuery, strings.Join(refs, " "), strings.Join(preds, ", ")))
+		if err != nil {
+			log.Printf("looking up table values: %v", err)
+			continue
+		}
+		for _, row := range rows {
+			if values[row["s"]] == nil {
+				values[row["s"]] = make(map[string][]string)
+			}
+			values[row["s"]][row["p"]] = append(values[row["s"]][row["p"]], srv.compactIRI(row["o"]))
+		}
+	}
+	return values
+}
+
+// writeTables writes the tables of the values of the resource, with the
+// labels of the values and the configured columns. The columns can be
+// sorted by the script.
+func (srv server) writeTables(w io.Writer, s htmlStyle, res resolution, tables []*valueTable) {
+	if len(tables) == 0 {
+		return
+	}
+	var iris []string
+	for _, t := range tables {
+		for _, o := range t.rows {
+			iris = append(iris, o.Name())
+		}
+	}
+	values := srv.tableValues(res.graph, iris)
+	for _, t := range tables {
+		fmt.Fprintf(w, "<section class=\"table\" id=\"%s\">\n<h2>%s (%d)</h2>\n<table class=\"sortable\">\n<thead><tr><th>Resource</th><th>Label</th>",
+			t.id, s.predicate(t.pred), len(t.rows))
+		for _, c := range srv.tables.Columns {
+			fmt.Fprintf(w, "<th>%s</th>", html.EscapeString(c.Title))
+		}
+		io.WriteString(w, "</tr></thead>\n<tbody>\n")
+		for _, o := range t.rows {
+			href, text := o.Name(), o.Name()
+			if rel, ok := s.link(o.Name()); ok {
+				href, text = s.rt.prefix+"/"+rel, rel
+			}
+			fmt.Fprintf(w, "<tr><td><a href=\"%s\">%s</a></td><td>%s</td>", escapeHref(href), html.EscapeString(text), html.EscapeString(s.labels[o.Name()]))
+			for _, c := range srv.tables.Columns {
+				fmt.Fprintf(w, "<td>%s</td>", html.EscapeString(strings.Join(values[o.Name()][c.Predicate], ", ")))
+			}
+			io.WriteString(w, "</tr>\n")
+		}
+		io.WriteString(w, "</tbody>\n</table>\n</section>\n")
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// defaultHTMLTemplates are the built-in templates of the HTML views. The
+// "turtle", "microdata", "search", "browse", "diff", "query" and "viz"
+// pages share the "header" and "footer" templates, which can be redefined
+// to brand the pages. The pages of resources start with a "truncated"
+// notice, if cut off, and end with their "permalink" and "sparql" query
+// panel.
+const defaultHTMLTemplates = `{{define "header"}}<!DOCTYPE html>
+<html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><meta name="color-scheme" content="light dark">
+<title>{{.Title}}{{if .Brand.Title}} | {{.Brand.Title}}{{end}}</title><link rel="stylesheet" href="` + staticPath + stylesheetName + `">
+<script src="` + staticPath + scriptName + `" defer></script>{{.Head}}</head><body>{{if or .Brand.Title .Brand.Logo .Search}}
+<header>{{if or .Brand.Title .Brand.Logo}}<span class="brand">{{if .Brand.Logo}}<img src="{{.Brand.Logo}}" alt="{{.Brand.Title}}">{{else}}{{.Brand.Title}}{{end}}</span>{{end}}{{if .Search}}<form action="{{.Search}}"><input type="search" name="q" value="{{.Query}}"> <input type="submit" value="Search"></form>{{end}}</header>{{end}}
+<main>{{end}}
+{{define "footer"}}</main>{{if .Brand.Footer}}
+<footer>{{.Brand.Footer}}</footer>{{end}}</body></html>{{end}}
+{{define "formats"}}{{if .Formats}}
+<nav class="formats">Download:{{range .Formats}} <a rel="alternate" type="{{.MediaType}}" href="{{.Href}}">{{.Title}}</a>{{end}}{{if .Viz}} | <a href="{{.Viz}}">Graph</a>{{end}}</nav>{{end}}{{end}}
+{{define "languages"}}{{if .Languages}}
+<p class="languages">Languages:{{range .Languages}} {{if .Current}}<strong>{{.Tag}}</strong>{{else}}<a href="{{.Href}}" rel="nofollow">{{.Tag}}</a>{{end}}{{end}}</p>{{end}}{{end}}
+{{define "truncated"}}{{if .Truncated}}
+<p class="truncated">The description is truncated to its first {{.Truncated}} triples.</p>{{end}}{{end}}
+{{define "permalink"}}{{if .URI}}
+<section class="permalink"><h2>Permalink</h2>
+<input type="text" readonly value="{{.URI}}"> <button type="button" class="copy" data-copy="{{.URI}}">Copy</button>{{if .QRCode}}
+<img class="qr" src="{{.QRCode}}" alt="QR code of {{.URI}}">{{end}}
+</section>{{end}}{{end}}
+{{define "sparql"}}{{if .SPARQL}}
+<details class="sparql"><summary>SPARQL query</summary>
+<pre><code>{{.SPARQL}}</code></pre>
+<button type="button" class="copy" data-copy="{{.SPARQL}}">Copy</button> <a href="{{.SPARQLHref}}" rel="nofollow">Run against the endpoint</a>
+</details>{{end}}{{end}}
+{{define "turtle"}}{{template "header" .}}{{.Breadcrumbs}}{{template "formats" .}}{{if .Views}}
+<p class="views">{{if eq .View "labels"}}<a href="?view=turtle">Turtle view</a> | <strong>Label view</strong>{{else}}<strong>Turtle view</strong> | <a href="?view=labels">Label view</a>{{end}}</p>{{end}}{{template "languages" .}}{{template "truncated" .}}{{.Contents}}<pre>{{range .Prologue}}{{.}}
+{{end}}
+{{.Body}}</pre>{{.Nav}}{{.Tables}}{{.Incoming}}{{template "permalink" .}}{{template "sparql" .}}{{template "footer" .}}{{end}}
+{{define "microdata"}}{{template "header" .}}{{template "formats" .}}{{template "truncated" .}}
+{{.Body}}{{template "permalink" .}}{{template "sparql" .}}{{template "footer" .}}{{end}}
+{{define "search"}}{{template "header" .}}
+{{.Body}}{{template "footer" .}}{{end}}
+{{define "browse"}}{{template "header" .}}
+{{.Body}}{{template "footer" .}}{{end}}
+{{define "diff"}}{{template "header" .}}
+<h1>{{.Title}}</h1>
+{{template "truncated" .}}{{.Body}}{{template "footer" .}}{{end}}
+{{define "query"}}{{template "header" .}}
+<h1>{{.Title}}</h1>
+<form class="query-editor" action="` + sparqlPath + `" method="post">
+<div class="editor"><pre aria-hidden="true"></pre><textarea name="query" spellcheck="false" aria-label="Query">{{.SPARQL}}</textarea></div>
+<p><input type="submit" value="Run"> <span class="status"></span></p>
+</form>
+<div id="results"></div>
+<script src="` + staticPath + queryScriptName + `" defer></script>{{template "footer" .}}{{end}}
+{{define "viz"}}{{template "header" .}}
+<h1>{{.Title}}</h1>
+{{.Body}}<svg id="viz" data-graph="{{.Graph}}"></svg>
+<script src="` + staticPath + vizScriptName + `" defer></script>{{template "footer" .}}{{end}}
+`
+
+// htmlPage is the data of the HTML page templates.
+type htmlPage struct {
+	Title string
+	// Head is added to the head element.
+	Head template.HTML
+	// Prologue are the base and prefix declarations of the Turtle view,
+	// one per line.
+	Prologue []template.HTML
+	// Breadcrumbs navigate to the resources above the resource, if any.
+	Breadcrumbs template.HTML
+	// Contents links to the predicates of the description, if it is long.
+	Contents template.HTML
+	// Body is the description of the resource.
+	Body template.HTML
+	// Nav is the navigation of SKOS concepts, if any.
+	Nav template.HTML
+	// Tables show the values of predicates with many values, if any.
+	Tables template.HTML
+	// Incoming lists the resources linking to the resource, if any.
+	Incoming template.HTML
+	// URI is the resource described.
+	URI string
+	// QRCode is the URL of the QR code of the URI, if any.
+	QRCode string
+	// Truncated is the triple limit the description was cut off at, if
+	// it was.
+	Truncated int
+	// SPARQL is the query describing the resource, if the query panel is
+	// enabled, and SPARQLHref runs it against the endpoint. On the query
+	// page, it is the query edited.
+	SPARQL     string
+	SPARQLHref string
+	// Formats link to the description in other formats.
+	Formats []formatLink
+	// Viz is the URL of the neighborhood diagram of the resource, if any,
+	// and Graph the URL of the data of the diagram of the viz page.
+	Viz   string
+	Graph string
+	// Languages filter the description by the language of its literals,
+	// if it has more than one.
+	Languages []languageLink
+	// Views is set if the Turtle view can be switched to the label view,
+	// and View is the current view, "turtle" or "labels".
+	Views bool
+	View  string
+	// Brand names the deployment.
+	Brand brandingConfig
+	// Search is the path of the search page, if searching is enabled,
+	// and Query the search terms of the search page.
+	Search string
+	Query  string
+}
+
+// loadHTMLTemplates returns the built-in HTML templates, with the
+// templates defined by the *.html files in dir added, if dir is not
+// empty. The files can redefine any of the built-in templates.
+func loadHTMLTemplates(dir string) (*template.Template, error) {
+	t, err := template.New("html").Parse(defaultHTMLTemplates)
+	if err != nil {
+		return nil, fmt.Errorf("html templates: %v", err)
+	}
+	if dir != "" {
+		if t, err = t.ParseGlob(filepath.Join(dir, "*.html")); err != nil {
+			return nil, fmt.Errorf("html templates: %v", err)
+		}
+	}
+	return t, nil
+}
+
+// writeHTMLPage renders page with the named template.
+func (srv server) writeHTMLPage(w io.Writer, name string, page htmlPage) error {
+	if srv.searchPageSize > 0 {
+		page.Search = searchPath
+	}
+	page.Brand = srv.branding
+	return srv.htmlTemplates.ExecuteTemplate(w, name, page)
+}
+
+// unsafeURL replaces link targets that are not safe to follow, like
+// html/template does.
+const unsafeURL = "#ZgotmplZ"
+
+// escapeHref returns href escaped for a href attribute. Links with a
+// scheme other than http, https and mailto are replaced, so that a
+// javascript: IRI in the data cannot run when followed.
+func escapeHref(href string) string {
+	u, err := url.Parse(href)
+	if err != nil {
+		return unsafeURL
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "", "http", "https", "mailto":
+		return html.EscapeString(href)
+	}
+	return unsafeURL
+}
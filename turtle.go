@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/knakk/kbp/rdf"
+)
+
+// rgxpLocalName matches the local names we abbreviate as prefixed names in
+// Turtle. It is a conservative subset of what the grammar allows.
+var rgxpLocalName = regexp.MustCompile(`^([A-Za-z0-9_]([A-Za-z0-9_.-]*[A-Za-z0-9_-])?)?$`)
+
+// rgxpShorthand matches the lexical forms of the datatypes which can be
+// written without quotes in Turtle.
+var rgxpShorthand = map[string]*regexp.Regexp{
+	xsdNS + "integer": regexp.MustCompile(`^[+-]?[0-9]+$`),
+	xsdNS + "decimal": regexp.MustCompile(`^[+-]?[0-9]*\.[0-9]+$`),
+	xsdNS + "double":  regexp.MustCompile(`^[+-]?([0-9]+\.[0-9]*|\.[0-9]+|[0-9]+)[eE][+-]?[0-9]+$`),
+	xsdNS + "boolean": regexp.MustCompile(`^(true|false)$`),
+}
+
+// turtleStyle renders terms in Turtle syntax.
+type turtleStyle struct {
+	srv server
+}
+
+func (s turtleStyle) predicate(p rdf.NamedNode) string {
+	if p.Name() == rdfType {
+		return "a"
+	}
+	return s.iri(p.Name())
+}
+
+func (s turtleStyle) object(p rdf.NamedNode, o rdf.Node) string {
+	return s.term(o)
+}
+
+func (s turtleStyle) nest(p rdf.NamedNode, b rdf.BlankNode) (open, close string) {
+	return "[\n", "\n\t]"
+}
+
+func (s turtleStyle) list(p rdf.NamedNode, items []rdf.Node) string {
+	terms := make([]string, len(items))
+	for i, item := range items {
+		terms[i] = s.term(item)
+	}
+	return "( " + strings.Join(terms, " ") + " )"
+}
+
+// term renders a node in Turtle syntax.
+func (s turtleStyle) term(o rdf.Node) string {
+	switch n := o.(type) {
+	case rdf.NamedNode:
+		return s.iri(n.Name())
+	case rdf.Literal:
+		return s.literal(n)
+	}
+	return ntTerm(o)
+}
+
+// literal renders l with its language tag or datatype, abbreviating the
+// datatype IRI. With the shorthand setting, numbers and booleans are
+// written without quotes.
+func (s turtleStyle) literal(l rdf.Literal) string {
+	v := l.ValueAsString()
+	if l.Lang() != "" {
+		return `"` + ntEscaper.Replace(v) + `"@` + l.Lang()
+	}
+	dt := l.DataType().Name()
+	if dt == "" || dt == xsdString {
+		return `"` + ntEscaper.Replace(v) + `"`
+	}
+	if rgxp, ok := rgxpShorthand[dt]; ok && s.srv.turtleShorthand && rgxp.MatchString(v) {
+		return v
+	}
+	return `"` + ntEscaper.Replace(v) + `"^^` + s.iri(dt)
+}
+
+// iri returns iri as a prefixed name if possible, or else as an IRI
+// reference.
+func (s turtleStyle) iri(iri string) string {
+	if c := s.srv.compactIRI(iri); c != iri {
+		if i := strings.Index(c, ":"); rgxpLocalName.MatchString(c[i+1:]) {
+			return c
+		}
+	}
+	return "<" + iri + ">"
+}
+
+// writeTurtle writes the description in Turtle, grouped and sorted like
+// the HTML view. The described resource comes first, followed by any other
+// subjects. Blank nodes referenced once are nested where they are
+// referenced, and the others written by label.
+func (srv server) writeTurtle(w io.Writer, res resolution, trs []rdf.Triple) error {
+	srv.writeTurtlePrefixes(w)
+	return srv.writeTurtleTriples(w, res, trs)
+}
+
+// writeTriG writes the description in TriG, as Turtle wrapped in the
+// graph it was fetched from. A description fetched from a union of graphs
+// is written in the default graph.
+func (srv server) writeTriG(w io.Writer, res resolution, trs []rdf.Triple) error {
+	srv.writeTurtlePrefixes(w)
+	gs := defaultGraphs(res.graph)
+	if len(gs) != 1 {
+		return srv.writeTurtleTriples(w, res, trs)
+	}
+	fmt.Fprintf(w, "\n<%s> {", gs[0])
+	if err := srv.writeTurtleTriples(w, res, trs); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "}\n")
+	return err
+}
+
+// writeTurtlePrefixes writes the prefix declarations of the prefix table.
+func (srv server) writeTurtlePrefixes(w io.Writer) {
+	for _, name := range sortedPrefixes(srv.prefixes) {
+		fmt.Fprintf(w, "@prefix %s: <%s> .\n", name, srv.prefixes[name])
+	}
+}
+
+// writeTurtleTriples writes the triples of the description, one subject
+// at a time.
+func (srv server) writeTurtleTriples(w io.Writer, res resolution, trs []rdf.Triple) error {
+	style := turtleStyle{srv: srv}
+	tw := tabwriter.NewWriter(w, 0, 0, 4, ' ', 0)
+	nested := nestedBlankNodes(trs)
+	for _, subj := range topSubjects(res, trs, nested) {
+		fmt.Fprintf(tw, "\n%s\n", style.term(subj))
+		srv.describe(tw, style, trs, subj, nested)
+		fmt.Fprint(tw, " .\n")
+	}
+	return tw.Flush()
+}
+
+// topSubjects returns the subjects of trs which are not nested in the
+// description of another subject, with the described resource first.
+func topSubjects(res resolution, trs []rdf.Triple, nested map[rdf.Node]bool) []rdf.Node {
+	main := rdf.NewNamedNode(res.uri)
+	var subjects []rdf.Node
+	seen := map[rdf.Node]bool{main: true}
+	for _, tr := range trs {
+		if tr.Subject == main {
+			subjects = append(subjects, main)
+			break
+		}
+	}
+	for _, tr := range trs {
+		if seen[tr.Subject] || nested[tr.Subject] {
+			continue
+		}
+		seen[tr.Subject] = true
+		subjects = append(subjects, tr.Subject)
+	}
+	return subjects
+}
+
+// nestedBlankNodes returns the blank nodes of trs which can be nested
+// where they are referenced: those referenced exactly once, and not in a
+// cycle of such blank nodes. Nesting the others would write them as
+// several nodes, or never end.
+func nestedBlankNodes(trs []rdf.Triple) map[rdf.Node]bool {
+	refs := make(map[rdf.Node]int)
+	parent := make(map[rdf.Node]rdf.Node)
+	for _, tr := range trs {
+		if b, ok := tr.Object.(rdf.BlankNode); ok {
+			refs[b]++
+			parent[b] = tr.Subject
+		}
+	}
+	nested := make(map[rdf.Node]bool)
+	for b, n := range refs {
+		if n != 1 {
+			continue
+		}
+		// Up the references to a subject which is written on its own,
+		// unless they lead back around.
+		seen := map[rdf.Node]bool{b: true}
+		for p := parent[b]; !seen[p]; p = parent[p] {
+			if refs[p] != 1 {
+				nested[b] = true
+				break
+			}
+			seen[p] = true
+		}
+	}
+	return nested
+}
+
+const (
+	rdfFirst = "http://www.w3.org/1999/02/22-rdf-syntax-ns#first"
+	rdfRest  = "http://www.w3.org/1999/02/22-rdf-syntax-ns#rest"
+	rdfNil   = "http://www.w3.org/1999/02/22-rdf-syntax-ns#nil"
+)
+
+// rdfList returns the items of the list starting at b. ok is false unless
+// the list is well-formed, i.e. each node is a blank node with exactly
+// one rdf:first and one rdf:rest and no other properties, not referenced
+// elsewhere, ending in rdf:nil. Lists of blank nodes are not collected,
+// as they couldn't be nested.
+func rdfList(b rdf.BlankNode, trs []rdf.Triple) (items []rdf.Node, ok bool) {
+	refs := make(map[rdf.Node]int)
+	for _, tr := range trs {
+		if o, ok := tr.Object.(rdf.BlankNode); ok {
+			refs[o]++
+		}
+	}
+	seen := make(map[rdf.Node]bool)
+	var node rdf.Node = b
+	for {
+		if n, ok := node.(rdf.NamedNode); ok && n.Name() == rdfNil {
+			return items, len(items) > 0
+		}
+		if _, ok := node.(rdf.BlankNode); !ok || seen[node] || refs[node] != 1 {
+			return nil, false
+		}
+		seen[node] = true
+		var first, rest rdf.Node
+		for _, tr := range trs {
+			if tr.Subject != node {
+				continue
+			}
+			switch {
+			case tr.Predicate.Name() == rdfFirst && first == nil:
+				first = tr.Object
+			case tr.Predicate.Name() == rdfRest && rest == nil:
+				rest = tr.Object
+			default:
+				return nil, false
+			}
+		}
+		if first == nil || rest == nil {
+			return nil, false
+		}
+		if _, ok := first.(rdf.BlankNode); ok {
+			return nil, false
+		}
+		items = append(items, first)
+		node = rest
+	}
+}
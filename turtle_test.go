@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// testBlankNodes links the work to blank nodes referenced once, twice, in
+// a cycle and from themselves.
+const testBlankNodes = `<http://data.deichman.no/work/w1> <http://data.deichman.no/ontology#contributor> _:once .
+_:once <http://data.deichman.no/ontology#role> _:nested .
+_:nested <http://www.w3.org/2000/01/rdf-schema#label> "Author" .
+<http://data.deichman.no/work/w1> <http://data.deichman.no/ontology#subject> _:twice .
+<http://data.deichman.no/work/w1> <http://data.deichman.no/ontology#genre> _:twice .
+_:twice <http://data.deichman.no/ontology#part> _:underTwice .
+_:underTwice <http://www.w3.org/2000/01/rdf-schema#label> "Part" .
+_:cycle1 <http://www.w3.org/2000/01/rdf-schema#seeAlso> _:cycle2 .
+_:cycle2 <http://www.w3.org/2000/01/rdf-schema#seeAlso> _:cycle1 .
+_:self <http://www.w3.org/2000/01/rdf-schema#seeAlso> _:self .
+`
+
+func TestNestedBlankNodes(t *testing.T) {
+	trs, err := decodeTriples(strings.NewReader(testBlankNodes), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nested := nestedBlankNodes(trs)
+	// The blank nodes are told by the predicates referencing them.
+	tests := map[string]bool{
+		"http://data.deichman.no/ontology#contributor": true,
+		"http://data.deichman.no/ontology#role":        true,
+		"http://data.deichman.no/ontology#part":        true,
+		"http://data.deichman.no/ontology#subject":     false,
+		"http://data.deichman.no/ontology#genre":       false,
+		"http://www.w3.org/2000/01/rdf-schema#seeAlso": false,
+	}
+	for _, tr := range trs {
+		want, ok := tests[tr.Predicate.Name()]
+		if ok && nested[tr.Object] != want {
+			t.Errorf("%s: nested = %v, want %v", ntriple(tr), nested[tr.Object], want)
+		}
+	}
+}
+
+func TestWriteTurtleBlankNodes(t *testing.T) {
+	trs, err := decodeTriples(strings.NewReader(testBlankNodes), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := (server{}).writeTurtle(&b, resolution{uri: testWork}, trs); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	// The blank nodes referenced twice, from themselves and in a cycle
+	// are written by label, as subject and where referenced.
+	if n := strings.Count(out, "_:"); n != 9 {
+		t.Errorf("%d blank node labels, want 9:\n%s", n, out)
+	}
+	for _, v := range []string{`"Author"`, `"Part"`} {
+		if n := strings.Count(out, v); n != 1 {
+			t.Errorf("%s occurs %d times, want 1:\n%s", v, n, out)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// upstream holds the *http.Client sending requests to the SPARQL
+// endpoints. It is replaced when the configuration is reloaded.
+var upstream atomic.Value
+
+func init() {
+	upstream.Store(http.DefaultClient)
+}
+
+// upstreamClient returns the client of the SPARQL endpoints.
+func upstreamClient() *http.Client {
+	return upstream.Load().(*http.Client)
+}
+
+// setUpstreamClient replaces the client of the SPARQL endpoints. The idle
+// connections of the old client are closed, while the requests in flight
+// are finished with it.
+func setUpstreamClient(c *http.Client) {
+	old := upstreamClient()
+	upstream.Store(c)
+	old.CloseIdleConnections()
+}
+
+// newUpstreamClient returns the client of the SPARQL endpoints, with the
+// configured timeouts, connection pool, replicas of the main endpoint,
+// retries and circuit breaker, adding the configured credentials and
+// headers to the requests. There is no overall timeout, so that large
+// exports can be streamed, but a hung endpoint is given up on when it
+// doesn't start responding in time.
+func newUpstreamClient(endpoint string, cfg upstreamConfig) (*http.Client, error) {
+	switch cfg.Auth {
+	case "", "basic", "digest":
+	default:
+		return nil, fmt.Errorf("invalid upstream auth: %q", cfg.Auth)
+	}
+	var transport http.RoundTripper = &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   cfg.ConnectTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          cfg.MaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       cfg.MaxConnsPerHost,
+		IdleConnTimeout:       cfg.IdleConnTimeout,
+		ResponseHeaderTimeout: cfg.ResponseTimeout,
+	}
+	if cfg.Auth != "" || len(cfg.Headers) > 0 {
+		transport = &upstreamTransport{cfg: cfg, next: transport, challenges: make(map[string]map[string]string)}
+	}
+	if len(cfg.Replicas) > 0 {
+		pool, err := newPoolTransport(transport, endpoint, cfg.Replicas)
+		if err != nil {
+			return nil, fmt.Errorf("replicas: %v", err)
+		}
+		pool.balance = cfg.Balance
+		transport = pool
+	}
+	if cfg.Retries > 0 {
+		transport = retryTransport{next: transport, retries: cfg.Retries, backoff: cfg.RetryBackoff}
+	}
+	if cfg.BreakerThreshold > 0 {
+		transport = newBreakerTransport(transport, cfg.BreakerThreshold, cfg.BreakerCooldown)
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+// upstreamTransport authenticates requests to the SPARQL endpoints. With
+// digest authentication, the last challenge of each host is reused, so
+// that only the first request, and those after the nonce has expired,
+// are answered with a 401 and sent again.
+type upstreamTransport struct {
+	cfg  upstreamConfig
+	next http.RoundTripper
+
+	mu         sync.Mutex
+	challenges map[string]map[string]string
+	nc         int
+}
+
+// CloseIdleConnections closes the idle connections of the wrapped
+// transport.
+func (t *upstreamTransport) CloseIdleConnections() {
+	closeIdleConnections(t.next)
+}
+
+// closeIdleConnections closes the idle connections of rt, if it keeps
+// any.
+func closeIdleConnections(rt http.RoundTripper) {
+	if c, ok := rt.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+func (t *upstreamTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for k, v := range t.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	switch t.cfg.Auth {
+	case "basic":
+		req.SetBasicAuth(t.cfg.Username, t.cfg.Password)
+		return t.next.RoundTrip(req)
+	case "digest":
+	default:
+		return t.next.RoundTrip(req)
+	}
+
+	t.mu.Lock()
+	if auth := t.authorization(req, t.challenges[req.URL.Host]); auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	t.mu.Unlock()
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || req.Body != nil && req.GetBody == nil {
+		return resp, err
+	}
+	var challenge map[string]string
+	for _, h := range resp.Header["Www-Authenticate"] {
+		if challenge = parseDigestChallenge(h); challenge != nil {
+			break
+		}
+	}
+	if challenge == nil {
+		return resp, nil
+	}
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+	}
+	t.mu.Lock()
+	t.challenges[req.URL.Host], t.nc = challenge, 0
+	auth := t.authorization(retry, challenge)
+	t.mu.Unlock()
+	if auth == "" {
+		return resp, nil
+	}
+	resp.Body.Close()
+	retry.Header.Set("Authorization", auth)
+	return t.next.RoundTrip(retry)
+}
+
+// authorization returns the Authorization header answering the digest
+// challenge for req, or an empty string if there is no challenge or its
+// algorithm is not supported. MD5 and SHA-256 are supported, with or
+// without qop=auth. The caller must hold t.mu.
+func (t *upstreamTransport) authorization(req *http.Request, challenge map[string]string) string {
+	if challenge == nil {
+		return ""
+	}
+	algorithm := challenge["algorithm"]
+	var h func() hash.Hash
+	switch strings.ToUpper(algorithm) {
+	case "", "MD5":
+		h, algorithm = md5.New, "MD5"
+	case "SHA-256":
+		h = sha256.New
+	default:
+		return ""
+	}
+	sum := func(s string) string {
+		d := h()
+		d.Write([]byte(s))
+		return hex.EncodeToString(d.Sum(nil))
+	}
+	uri := req.URL.RequestURI()
+	ha1 := sum(t.cfg.Username + ":" + challenge["realm"] + ":" + t.cfg.Password)
+	ha2 := sum(req.Method + ":" + uri)
+
+	auth := fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", algorithm=%s`,
+		t.cfg.Username, challenge["realm"], challenge["nonce"], uri, algorithm)
+	qopAuth := false
+	for _, qop := range strings.Split(challenge["qop"], ",") {
+		qopAuth = qopAuth || strings.TrimSpace(qop) == "auth"
+	}
+	if qopAuth {
+		t.nc++
+		nc := fmt.Sprintf("%08x", t.nc)
+		b := make([]byte, 8)
+		rand.Read(b)
+		cnonce := hex.EncodeToString(b)
+		auth += fmt.Sprintf(`, qop=auth, nc=%s, cnonce="%s", response="%s"`, nc, cnonce,
+			sum(ha1+":"+challenge["nonce"]+":"+nc+":"+cnonce+":auth:"+ha2))
+	} else {
+		auth += fmt.Sprintf(`, response="%s"`, sum(ha1+":"+challenge["nonce"]+":"+ha2))
+	}
+	if opaque, ok := challenge["opaque"]; ok {
+		auth += fmt.Sprintf(`, opaque="%s"`, opaque)
+	}
+	return auth
+}
+
+// parseDigestChallenge returns the parameters of the digest challenge of
+// a WWW-Authenticate header, or nil if it is not one.
+func parseDigestChallenge(h string) map[string]string {
+	if len(h) < 7 || !strings.EqualFold(h[:7], "Digest ") {
+		return nil
+	}
+	params := make(map[string]string)
+	s := h[7:]
+	for {
+		s = strings.TrimLeft(s, " ,")
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = s[eq+1:]
+		var val string
+		if strings.HasPrefix(s, `"`) {
+			end := strings.IndexByte(s[1:], '"')
+			if end < 0 {
+				return nil
+			}
+			val, s = s[1:end+1], s[end+2:]
+		} else {
+			end := strings.IndexByte(s, ',')
+			if end < 0 {
+				end = len(s)
+			}
+			val, s = strings.TrimSpace(s[:end]), s[end:]
+		}
+		params[key] = val
+	}
+	if params["nonce"] == "" {
+		return nil
+	}
+	return params
+}
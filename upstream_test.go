@@ -0,0 +1,185 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestParseDigestChallenge(t *testing.T) {
+	tests := []struct {
+		header string
+		want   map[string]string
+	}{
+		{`Digest realm="Virtuoso", nonce="abc", qop="auth", algorithm=MD5`,
+			map[string]string{"realm": "Virtuoso", "nonce": "abc", "qop": "auth", "algorithm": "MD5"}},
+		// Commas and equals signs in quoted values.
+		{`Digest realm="SPARQL, secured", nonce="a=b,c", qop="auth,auth-int"`,
+			map[string]string{"realm": "SPARQL, secured", "nonce": "a=b,c", "qop": "auth,auth-int"}},
+		// No qop, as in RFC 2069.
+		{`Digest realm="Virtuoso",nonce="abc",opaque="xyz"`,
+			map[string]string{"realm": "Virtuoso", "nonce": "abc", "opaque": "xyz"}},
+		{`Digest realm="Virtuoso", nonce="def", qop="auth", stale=true`,
+			map[string]string{"realm": "Virtuoso", "nonce": "def", "qop": "auth", "stale": "true"}},
+		{`digest Realm="Virtuoso", NONCE="abc"`,
+			map[string]string{"realm": "Virtuoso", "nonce": "abc"}},
+		{`Basic realm="Virtuoso"`, nil},
+		{`Digest realm="Virtuoso"`, nil},
+		{`Digest realm="Virtuoso, nonce="abc`, nil},
+		{`Digest realm="Virtuoso", nonce="abc`, nil},
+		{`Digest`, nil},
+	}
+	for _, test := range tests {
+		if got := parseDigestChallenge(test.header); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseDigestChallenge(%q) = %v, want %v", test.header, got, test.want)
+		}
+	}
+}
+
+// testDigestResponse returns the response expected to the digest
+// challenge, given the parameters of the authorization.
+func testDigestResponse(h func() hash.Hash, method, password string, auth map[string]string) string {
+	sum := func(s string) string {
+		d := h()
+		d.Write([]byte(s))
+		return hex.EncodeToString(d.Sum(nil))
+	}
+	ha1 := sum(auth["username"] + ":" + auth["realm"] + ":" + password)
+	ha2 := sum(method + ":" + auth["uri"])
+	if auth["qop"] == "" {
+		return sum(ha1 + ":" + auth["nonce"] + ":" + ha2)
+	}
+	return sum(ha1 + ":" + auth["nonce"] + ":" + auth["nc"] + ":" + auth["cnonce"] + ":" + auth["qop"] + ":" + ha2)
+}
+
+func TestDigestAuthorization(t *testing.T) {
+	tests := []struct {
+		challenge string
+		h         func() hash.Hash
+		want      map[string]string // expected parameters, besides the response
+	}{
+		{`Digest realm="Virtuoso", nonce="abc", qop="auth"`, md5.New,
+			map[string]string{"algorithm": "MD5", "qop": "auth", "nc": "00000001"}},
+		// Without qop, there is no nonce count or client nonce.
+		{`Digest realm="Virtuoso", nonce="abc"`, md5.New,
+			map[string]string{"algorithm": "MD5", "qop": "", "nc": ""}},
+		{`Digest realm="Virtuoso", nonce="abc", qop="auth-int, auth", algorithm=SHA-256`, sha256.New,
+			map[string]string{"algorithm": "SHA-256", "qop": "auth", "nc": "00000001"}},
+		// auth-int alone is not supported, so the response is that of
+		// RFC 2069.
+		{`Digest realm="Virtuoso", nonce="abc", qop="auth-int"`, md5.New,
+			map[string]string{"algorithm": "MD5", "qop": ""}},
+		{`Digest realm="SPARQL, secured", nonce="abc", opaque="xyz"`, md5.New,
+			map[string]string{"realm": "SPARQL, secured", "opaque": "xyz"}},
+		{`Digest realm="Virtuoso", nonce="abc", algorithm=SHA-512-256`, nil, nil},
+	}
+	for _, test := range tests {
+		tr := &upstreamTransport{cfg: upstreamConfig{Auth: "digest", Username: "dba", Password: "secret"}}
+		req := httptest.NewRequest("GET", "http://virtuoso:8890/sparql/?query=ASK%7B%7D", nil)
+		got := tr.authorization(req, parseDigestChallenge(test.challenge))
+		if test.h == nil {
+			if got != "" {
+				t.Errorf("authorization(%q) = %q, want none", test.challenge, got)
+			}
+			continue
+		}
+		auth := parseDigestChallenge(got)
+		if auth == nil {
+			t.Errorf("authorization(%q) = %q, not a digest authorization", test.challenge, got)
+			continue
+		}
+		if auth["username"] != "dba" || auth["uri"] != "/sparql/?query=ASK%7B%7D" {
+			t.Errorf("authorization(%q) = %q, want username dba and the request URI", test.challenge, got)
+		}
+		for k, v := range test.want {
+			if auth[k] != v {
+				t.Errorf("authorization(%q): %s = %q, want %q", test.challenge, k, auth[k], v)
+			}
+		}
+		if want := testDigestResponse(test.h, "GET", "secret", auth); auth["response"] != want {
+			t.Errorf("authorization(%q): response = %q, want %q", test.challenge, auth["response"], want)
+		}
+	}
+}
+
+// TestDigestStale checks that the challenge of a host is reused, and that
+// requests refused with a stale nonce are sent again with the new one,
+// bodies included.
+func TestDigestStale(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		nonce    string
+		requests int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		auth := parseDigestChallenge(r.Header.Get("Authorization"))
+		if auth == nil || auth["nonce"] != nonce ||
+			auth["response"] != testDigestResponse(md5.New, r.Method, "secret", auth) {
+			stale := ""
+			if auth != nil {
+				stale = ", stale=true"
+			}
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Digest realm="Virtuoso", nonce="%s", qop="auth"%s`, nonce, stale))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s", body)
+	}))
+	defer srv.Close()
+
+	tr := &upstreamTransport{
+		cfg:        upstreamConfig{Auth: "digest", Username: "dba", Password: "secret"},
+		next:       http.DefaultTransport,
+		challenges: make(map[string]map[string]string),
+	}
+	client := &http.Client{Transport: tr}
+	post := func() string {
+		resp, err := client.Post(srv.URL+"/sparql/", "application/sparql-query", strings.NewReader("ASK {}"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("got %s, want 200 OK", resp.Status)
+		}
+		b, _ := ioutil.ReadAll(resp.Body)
+		return string(b)
+	}
+
+	steps := []struct {
+		nonce    string
+		requests int // sent to the server for the step
+	}{
+		{"n1", 2}, // challenged
+		{"n1", 1}, // challenge reused
+		{"n2", 2}, // stale nonce
+		{"n2", 1},
+	}
+	for i, step := range steps {
+		mu.Lock()
+		nonce, requests = step.nonce, 0
+		mu.Unlock()
+		if body := post(); body != "ASK {}" {
+			t.Errorf("step %d: body = %q, want the query", i, body)
+		}
+		mu.Lock()
+		n := requests
+		mu.Unlock()
+		if n != step.requests {
+			t.Errorf("step %d: %d requests, want %d", i, n, step.requests)
+		}
+	}
+}
@@ -1,126 +1,909 @@
 package main
 
 import (
-	"flag"
+	"bytes"
+	"context"
+	"crypto/tls"
 	"fmt"
+	"html"
+	"html/template"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"os/signal"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"text/tabwriter"
+	"time"
+	"unicode/utf8"
 
-	"github.com/golang/gddo/httputil"
 	"github.com/knakk/kbp/rdf"
+	"golang.org/x/sync/singleflight"
 )
 
 const (
-	descQuery  = `DEFINE sql:describe-mode "CBD" DESCRIBE <%s%s>`
-	htmlHeader = `<html><head><title>%s</title></head><body><pre>@base              &lt;http://data.deichman.no/&gt .
-@prefix     deich: &lt;http://data.deichman.no/ontology#&gt; .
-@prefix       raw: &lt;http://data.deichman.no/raw#&gt; .
-@prefix migration: &lt;http://migration.deichman.no/&gt; .
-@prefix       duo: &lt;http://data.deichman.no/utility#&gt; .
-
-`
-	htmlFooter = `</pre></body></html>`
-)
+	descQuery = `DEFINE sql:describe-mode "%s" DESCRIBE <%s>`
 
-var repl = strings.NewReplacer(
-	"http://data.deichman.no/ontology#", "deich:",
-	"http://www.w3.org/1999/02/22-rdf-syntax-ns#type", "a",
-	"http://data.deichman.no/raw#", "raw:",
-	"http://migration.deichman.no/", "migration:",
-	"http://data.deichman.no/duo#", "duo:",
-)
+	// longLiteral is the length above which literals are folded in the
+	// HTML view.
+	longLiteral = 200
 
-var rgxpLinkify = regexp.MustCompile(`http://data.deichman.no/(place|publication|work|person|corporation|subject|genre|serial)/`)
+	// allowedMethods are the methods resources can be requested with.
+	allowedMethods = "GET, HEAD, OPTIONS"
+)
 
 type server struct {
-	graph  string
-	base   string
-	target string
+	resolver resolver
+	// backend describes the resources.
+	backend backend
+	// cache caches the descriptions of resources. It is nil if they are
+	// not cached.
+	cache descriptionCache
+	// revalidating holds the keys of the stale descriptions being
+	// refreshed.
+	revalidating *sync.Map
+	// lookups coalesces concurrent fetches of the same description.
+	lookups *singleflight.Group
+	// invalidateToken authenticates the requests evicting cached
+	// descriptions. They are refused if it is empty.
+	invalidateToken string
+	routes          []route
+	endpoints       []string
+	// replicas have copies of the data of the first endpoint, and take
+	// over its queries while it is down.
+	replicas []string
+	// retryAfter is the Retry-After given to clients in maintenance mode.
+	retryAfter time.Duration
+	prefixes   map[string]string
+	repl       *strings.Replacer
+	linkify    *regexp.Regexp
+	schema     schemaMapping
+	feed       feedConfig
+	geo        geoConfig
+	branding   brandingConfig
+	queryPanel queryPanelConfig
+	sparql     sparqlConfig
+	// contents is the number of values from which resources get a table
+	// of contents in the HTML view. It is disabled if it is 0.
+	contents int
+	// vizLimit is the maximum number of links of the neighborhood
+	// diagrams. They are disabled if it is 0.
+	vizLimit int
+	// qrCodes enables the QR codes of the permalinks.
+	qrCodes bool
+	// batchSize is the maximum number of resources described at once at
+	// /batch. It is disabled if it is 0.
+	batchSize int
+	// previews caches the labels of external resources, for the hover
+	// cards of the HTML view. It is nil if they are disabled.
+	previews *previews
+	// images are the predicates whose objects are rendered as images in
+	// the HTML view.
+	images map[string]bool
+	// predicateRank is the position of predicates in the configured
+	// display order.
+	predicateRank map[string]int
+	// propLabels are the labels of properties, for the label view of
+	// the HTML view. It is nil if the label view is disabled.
+	propLabels *propertyLabels
+	// ctx is the context of the request served by the copy of the server,
+	// canceling the queries when the client goes away.
+	ctx context.Context
+	// labelView is set on the copy of the server serving a request for
+	// the label view.
+	labelView bool
+	// languages are the languages of the literals of the resource, and
+	// lang the language asked for by the lang parameter, set on the copy
+	// of the server serving a HTML request.
+	languages []string
+	lang      string
+	// truncated is set on the copy of the server serving a description
+	// cut off at the triple limit.
+	truncated bool
+	// tripleLimit is the maximum number of triples of a description. It
+	// is unlimited if it is 0.
+	tripleLimit int
+	// queryTimeout is how long the endpoints may run the queries of a
+	// request. It is up to them if it is 0.
+	queryTimeout time.Duration
+	// maxRows is the maximum number of rows of the results of the
+	// endpoints, from which descriptions are fetched in pages. They are
+	// not if it is 0.
+	maxRows int
+	// modified is the predicate giving the modification time of
+	// resources, if any.
+	modified string
+	// things matches the URIs of non-information resources, relative to
+	// the base URI. It is nil if they are not redirected.
+	things *regexp.Regexp
+	deref  derefConfig
+	// corsOrigins are the origins allowed to make cross-origin requests,
+	// or "*" for any.
+	corsOrigins map[string]bool
+	corsMaxAge  time.Duration
+	// trustedProxies are the networks of proxies whose X-Forwarded-*
+	// headers are used.
+	trustedProxies []*net.IPNet
+	errorTemplate  *template.Template
+	// htmlTemplates render the pages of the HTML views.
+	htmlTemplates *template.Template
+	// searchURL links to a search for missing resources, with the search
+	// terms in place of {{query}}.
+	searchURL string
+	// tables configures the value tables, with the predicates expanded.
+	tables tableConfig
+	// crumbs configures the breadcrumbs, with the predicates expanded.
+	crumbs breadcrumbConfig
+	// browse configures the browse pages, with the classes expanded.
+	browse browseConfig
+	// searchPageSize is the number of results per page of the search
+	// page, or 0 if it is disabled.
+	searchPageSize int
+	marc           []marcConfig
+	// labels are the predicates giving the labels of linked resources,
+	// in order of preference.
+	labels  []string
+	hdtTool string
+	// incomingLimit is the maximum number of incoming links listed, and
+	// incomingRDF adds them to the RDF formats.
+	incomingLimit int
+	incomingRDF   bool
+	// staticDir is a directory with static assets, if any.
+	staticDir string
+	// exportDir is where HDT exports are kept, if anywhere.
+	exportDir string
+	// defaultFormat is the format used when the client has no preference.
+	defaultFormat outputFormat
+	// htmlMode selects the HTML renderer.
+	htmlMode string
+	// turtleShorthand writes numbers and booleans without quotes.
+	turtleShorthand bool
+}
+
+func newServer(cfg config) (server, error) {
+	srv := server{
+		routes:          newRoutes(cfg),
+		endpoints:       append([]string{cfg.Endpoint}, cfg.Federation...),
+		replicas:        cfg.Upstream.Replicas,
+		retryAfter:      cfg.MaintenanceRetryAfter,
+		lookups:         new(singleflight.Group),
+		prefixes:        cfg.Prefixes,
+		repl:            newPrefixReplacer(cfg.Prefixes),
+		schema:          newSchemaMapping(cfg.SchemaOrg, cfg.Prefixes),
+		feed:            cfg.Feed,
+		hdtTool:         cfg.HDTTool,
+		exportDir:       cfg.ExportDir,
+		staticDir:       cfg.StaticDir,
+		qrCodes:         cfg.QRCodes,
+		branding:        cfg.Branding,
+		queryPanel:      cfg.QueryPanel,
+		sparql:          cfg.SPARQL,
+		contents:        cfg.Contents,
+		vizLimit:        cfg.VizLimit,
+		tripleLimit:     cfg.TripleLimit,
+		maxRows:         cfg.MaxRows,
+		queryTimeout:    cfg.Upstream.QueryTimeout,
+		batchSize:       cfg.BatchSize,
+		incomingLimit:   cfg.Incoming.Limit,
+		incomingRDF:     cfg.Incoming.RDF,
+		htmlMode:        cfg.HTMLMode,
+		turtleShorthand: cfg.TurtleShorthand,
+	}
+	if srv.queryPanel.Endpoint == "" {
+		srv.queryPanel.Endpoint = cfg.Endpoint
+	}
+	if srv.htmlMode != htmlTurtle && srv.htmlMode != htmlMicrodata {
+		return srv, fmt.Errorf("invalid HTML mode: %q", srv.htmlMode)
+	}
+	if cfg.PropertyLabels.Graph != "" {
+		srv.propLabels = newPropertyLabels(cfg.PropertyLabels)
+	}
+	if len(cfg.Preview.Hosts) > 0 {
+		srv.previews = newPreviews(cfg.Preview)
+	}
+	if cfg.Cache.Size > 0 || cfg.Cache.Redis != "" {
+		srv.cache = newDescriptionCache(cfg.Cache)
+		srv.revalidating = new(sync.Map)
+		srv.invalidateToken = cfg.Cache.InvalidateToken
+	}
+	srv.images = make(map[string]bool)
+	for _, p := range cfg.Images {
+		srv.images[expandIRI(p, cfg.Prefixes)] = true
+	}
+	srv.predicateRank = make(map[string]int)
+	for i, p := range cfg.PredicateOrder {
+		srv.predicateRank[expandIRI(p, cfg.Prefixes)] = i
+	}
+	for _, p := range cfg.Labels {
+		if p != "" {
+			srv.labels = append(srv.labels, expandIRI(p, cfg.Prefixes))
+		}
+	}
+	for _, m := range cfg.MARC {
+		m.Predicate = expandIRI(m.Predicate, cfg.Prefixes)
+		srv.marc = append(srv.marc, m)
+	}
+	f, ok := lookupFormat(cfg.DefaultFormat)
+	if !ok || f.write == nil && len(srv.endpoints) > 1 {
+		return srv, fmt.Errorf("invalid default format: %q", cfg.DefaultFormat)
+	}
+	srv.defaultFormat = f
+	srv.searchURL = cfg.SearchURL
+	srv.searchPageSize = cfg.SearchPageSize
+	srv.tables.Threshold = cfg.Tables.Threshold
+	for _, c := range cfg.Tables.Columns {
+		c.Predicate = expandIRI(c.Predicate, cfg.Prefixes)
+		srv.tables.Columns = append(srv.tables.Columns, c)
+	}
+	if cfg.Breadcrumbs.Parent != "" {
+		srv.crumbs = breadcrumbConfig{Parent: expandIRI(cfg.Breadcrumbs.Parent, cfg.Prefixes), Limit: cfg.Breadcrumbs.Limit}
+		for _, p := range cfg.Breadcrumbs.Agents {
+			srv.crumbs.Agents = append(srv.crumbs.Agents, expandIRI(p, cfg.Prefixes))
+		}
+	}
+	if cfg.Browse.PageSize > 0 {
+		srv.browse = browseConfig{Classes: make(map[string]string), PageSize: cfg.Browse.PageSize}
+		for name, class := range cfg.Browse.Classes {
+			srv.browse.Classes[name] = expandIRI(class, cfg.Prefixes)
+		}
+	}
+	tmpl, err := loadErrorTemplate(cfg.ErrorTemplate)
+	if err != nil {
+		return srv, err
+	}
+	srv.errorTemplate = tmpl
+	if srv.htmlTemplates, err = loadHTMLTemplates(cfg.HTMLTemplates); err != nil {
+		return srv, err
+	}
+	trusted, err := parseNetworks(cfg.TrustedProxies)
+	if err != nil {
+		return srv, err
+	}
+	srv.trustedProxies = trusted
+	if len(cfg.CORS.Origins) > 0 {
+		srv.corsOrigins = make(map[string]bool)
+		for _, o := range cfg.CORS.Origins {
+			srv.corsOrigins[o] = true
+		}
+		srv.corsMaxAge = cfg.CORS.MaxAge
+	}
+	if cfg.Modified != "" {
+		srv.modified = expandIRI(cfg.Modified, cfg.Prefixes)
+	}
+	srv.geo.Latitude = expandIRI(cfg.Geo.Latitude, cfg.Prefixes)
+	srv.geo.Longitude = expandIRI(cfg.Geo.Longitude, cfg.Prefixes)
+	if srv.feed.Predicate != "" {
+		srv.feed.Predicate = expandIRI(srv.feed.Predicate, cfg.Prefixes)
+	}
+	res, err := newResolver(cfg, srv.routes)
+	if err != nil {
+		return srv, err
+	}
+	srv.resolver = res
+	if len(cfg.Dereference.Things) > 0 {
+		things, err := regexp.Compile("^(?:" + strings.Join(cfg.Dereference.Things, "|") + ")")
+		if err != nil {
+			return srv, fmt.Errorf("things: %v", err)
+		}
+		srv.things = things
+		srv.deref = cfg.Dereference
+	}
+	if len(cfg.Linkify) > 0 {
+		linkify, err := regexp.Compile("^(?:" + strings.Join(cfg.Linkify, "|") + ")")
+		if err != nil {
+			return srv, fmt.Errorf("linkify: %v", err)
+		}
+		srv.linkify = linkify
+	}
+	switch cfg.Backend {
+	case backendVirtuoso, backendSPARQL:
+		srv.backend = sparqlBackend{endpoints: srv.endpoints}
+		// The timeout parameter is Virtuoso's.
+		if cfg.Backend == backendSPARQL {
+			srv.queryTimeout = 0
+		}
+	case backendMemory:
+		if srv.backend, err = newMemoryBackend(cfg.Data); err != nil {
+			return srv, err
+		}
+		// Without endpoints, the features making queries of their own
+		// are turned off.
+		srv.endpoints, srv.replicas = nil, nil
+		srv.incomingLimit, srv.vizLimit, srv.searchPageSize, srv.maxRows = 0, 0, 0, 0
+		srv.tables.Threshold, srv.crumbs, srv.browse, srv.feed.Predicate = 0, breadcrumbConfig{}, browseConfig{}, ""
+		srv.labels, srv.propLabels = nil, nil
+		srv.sparql.Enabled, srv.queryPanel.Enabled = false, false
+	default:
+		return srv, fmt.Errorf("invalid backend: %q", cfg.Backend)
+	}
+	client, err := newUpstreamClient(cfg.Endpoint, cfg.Upstream)
+	if err != nil {
+		return srv, err
+	}
+	setUpstreamClient(client)
+	return srv, nil
+}
+
+// newPrefixReplacer returns a replacer abbreviating URIs using the given
+// prefix table. Longer namespaces are tried first, so that a namespace
+// nested within another is abbreviated with the most specific prefix.
+func newPrefixReplacer(prefixes map[string]string) *strings.Replacer {
+	names := sortedPrefixes(prefixes)
+	sort.SliceStable(names, func(i, j int) bool {
+		return len(prefixes[names[i]]) > len(prefixes[names[j]])
+	})
+	oldnew := []string{"http://www.w3.org/1999/02/22-rdf-syntax-ns#type", "a"}
+	for _, name := range names {
+		oldnew = append(oldnew, prefixes[name], name+":")
+	}
+	return strings.NewReplacer(oldnew...)
+}
+
+// sortedPrefixes returns the prefix names in alphabetical order.
+func sortedPrefixes(prefixes map[string]string) []string {
+	names := make([]string, 0, len(prefixes))
+	for name := range prefixes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// htmlPrologue returns the base and prefix declarations of the HTML
+// view, highlighted and aligned.
+func (srv server) htmlPrologue(rt route) []template.HTML {
+	names := sortedPrefixes(srv.prefixes)
+	width := len("@base ")
+	for _, name := range names {
+		if n := len("@prefix ") + len(name) + 1; n > width {
+			width = n
+		}
+	}
+	lines := []template.HTML{template.HTML(highlight(fmt.Sprintf("%-*s <%s/> .", width, "@base", rt.base)))}
+	for _, name := range names {
+		lines = append(lines, template.HTML(highlight(fmt.Sprintf("@prefix %*s <%s> .", width-len("@prefix "), name+":", srv.prefixes[name]))))
+	}
+	return lines
 }
 
 func (srv server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	srv.ctx = withQueryTimeout(r.Context(), srv.queryTimeout)
+	if srv.cors(w, r) {
+		return
+	}
+	// The SPARQL endpoint, batches and invalidations take POST requests
+	// as well.
+	if r.URL.Path == sparqlPath && srv.sparql.Enabled {
+		srv.serveSPARQL(w, r)
+		return
+	}
+	if r.URL.Path == batchPath && srv.batchSize > 0 {
+		srv.serveBatch(w, r)
+		return
+	}
+	if r.URL.Path == invalidatePath && srv.invalidateToken != "" {
+		srv.serveInvalidate(w, r)
+		return
+	}
+	switch r.Method {
+	case "GET", "HEAD":
+	case "OPTIONS":
+		w.Header().Set("Allow", allowedMethods)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		w.Header().Set("Allow", allowedMethods)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if srv.redirectCanonical(w, r) {
+		return
+	}
 	if r.URL.Path == "/favicon.ico" {
 		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
 		return
 	}
+	if r.URL.Path == feedPath && srv.feed.Predicate != "" {
+		srv.serveFeed(w, r)
+		return
+	}
+	if r.URL.Path == qrPath && srv.qrCodes {
+		srv.serveQR(w, r)
+		return
+	}
+	if r.URL.Path == queryEditorPath && srv.sparql.Enabled {
+		srv.serveQueryEditor(w, r)
+		return
+	}
+	if r.URL.Path == diffPath {
+		srv.serveDiff(w, r)
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, vizPath+"/") && srv.vizLimit > 0 {
+		srv.serveViz(w, r)
+		return
+	}
+	if r.URL.Path == previewPath && srv.previews != nil {
+		srv.servePreview(w, r)
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, staticPath) {
+		srv.serveStatic(w, r)
+		return
+	}
+	if r.URL.Path == searchPath && srv.searchPageSize > 0 {
+		srv.serveSearch(w, r)
+		return
+	}
+	if (r.URL.Path == browsePath || strings.HasPrefix(r.URL.Path, browsePath+"/")) && srv.browse.PageSize > 0 {
+		srv.serveBrowse(w, r)
+		return
+	}
 
-	format := httputil.NegotiateContentType(r, []string{"text/plain", "text/turtle", "application/rdf+xml", "text/html"}, "text/plain")
-	accept := format
-	if accept == "text/html" {
-		accept = "text/plain"
+	f, path, ok := formatByExtension(r.URL.Path)
+	// document is set when the path names a document describing the
+	// resource, rather than the resource itself.
+	document, page := ok, false
+	if p, ok := trimPathPrefix(path, srv.deref.Page); ok && srv.things != nil {
+		path, document, page = p, true, true
+	} else if p, ok := trimPathPrefix(path, srv.deref.Data); ok && srv.things != nil {
+		path, document = p, true
+	}
+	if name := r.URL.Query().Get("format"); name != "" {
+		if f, ok = formatByName(name); !ok {
+			http.Error(w, fmt.Sprintf("unknown format: %q", name), http.StatusBadRequest)
+			return
+		}
+	} else if page {
+		f, _ = formatByName("html")
+	} else if !ok {
+		f = srv.negotiateFormat(r)
+		// Tell caches the response depends on the Accept header, and
+		// where the chosen representation can be requested directly.
+		w.Header().Add("Vary", "Accept")
+		if f.extension != "" {
+			w.Header().Set("Content-Location", srv.absURL(r, (&url.URL{Path: r.URL.Path + f.extension}).EscapedPath()))
+		}
 	}
 	log.Println(r.Header["X-Forwarded-For"], r.URL.Path)
-	params := url.Values{}
-	params.Set("query", fmt.Sprintf(descQuery, srv.base, r.URL.Path))
-	params.Set("default-graph-uri", srv.graph)
-	params.Set("format", accept)
-	params.Encode()
-
-	req, err := http.NewRequest("POST", srv.target+params.Encode(), nil)
+	res, err := srv.resolver.resolve(path)
 	if err != nil {
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		srv.serveError(w, f, resolveStatus(err), err.Error(), nil)
 		return
 	}
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if !document && srv.isThing(res) {
+		srv.seeOther(w, r, f, path)
 		return
 	}
-	defer resp.Body.Close()
 
-	if format != "text/html" {
-		if _, err := io.Copy(w, resp.Body); err != nil {
+	// Formats vindu can write are fetched like the others, so that the
+	// descriptions are paged, truncated, cached and coalesced alike.
+	if f.proxy && f.write == nil && len(srv.endpoints) == 1 {
+		// HEAD requests are answered by reading the response without
+		// sending it, to get the same headers as a GET.
+		var body io.Writer = w
+		head := &countWriter{}
+		if r.Method == "HEAD" {
+			body = head
+		}
+		resp, err := query(srv.reqContext(), srv.endpoints[0], res.graph, res.query, f.mediaType)
+		if err != nil {
+			srv.serveError(w, f, upstreamStatus(w, err, http.StatusInternalServerError), err.Error(), &res)
+			return
+		}
+		defer resp.Body.Close()
+		w.Header().Set("Content-Type", f.contentType())
+		if _, err := io.Copy(body, resp.Body); err != nil {
 			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		if r.Method == "HEAD" {
+			w.Header().Set("Content-Length", strconv.FormatInt(head.n, 10))
 		}
 		return
 	}
 
+	// Stale descriptions are served while they are refreshed.
 	var trs []rdf.Triple
-	dec := rdf.NewDecoder(resp.Body)
-	for tr, err := dec.Decode(); err != io.EOF; tr, err = dec.Decode() {
+	var stale, hit bool
+	if srv.cache != nil {
+		trs, stale, hit = srv.cache.get(res)
+		switch {
+		case stale:
+			w.Header().Set("X-Cache", "STALE")
+			srv.revalidate(res)
+		case hit:
+			w.Header().Set("X-Cache", "HIT")
+		default:
+			w.Header().Set("X-Cache", "MISS")
+		}
+	}
+	if !hit {
+		trs, err = srv.fetchDescription(res)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			srv.serveError(w, f, upstreamStatus(w, err, http.StatusInternalServerError), err.Error(), &res)
 			return
 		}
-		trs = append(trs, tr)
+		if srv.cache != nil {
+			srv.cache.add(res, trs)
+		}
+	}
+	if trs, srv.truncated = srv.truncate(trs); srv.truncated {
+		w.Header().Set(truncatedHeader, strconv.Itoa(srv.tripleLimit))
 	}
 
 	if len(trs) == 0 {
-		http.NotFound(w, r)
+		srv.serveError(w, f, http.StatusNotFound, notFoundMessage(res), &res)
 		return
 	}
 
+	if srv.incomingLimit > 0 && (f.mediaType == "text/html" || srv.incomingRDF) {
+		in, err := srv.incoming(res)
+		if err != nil {
+			log.Printf("looking up incoming links: %v", err)
+		}
+		trs = append(trs, in...)
+	}
+
+	if f.mediaType == "text/html" {
+		srv.languages = literalLanguages(trs)
+		srv.lang = strings.ToLower(r.URL.Query().Get("lang"))
+	}
+	if lang := r.URL.Query().Get("lang"); lang != "" && f.localized {
+		trs = onlyLanguage(trs, lang)
+		if lang != "*" {
+			w.Header().Set("Content-Language", lang)
+		}
+	} else if f.localized {
+		w.Header().Add("Vary", "Accept-Language")
+		if ranges := acceptLanguages(r); len(ranges) > 0 {
+			var langs []string
+			trs, langs = filterLanguages(trs, ranges)
+			if len(langs) > 0 {
+				w.Header().Set("Content-Language", strings.Join(langs, ", "))
+			}
+		}
+	}
+
+	srv.sortTriples(trs)
+	tag := etag(f, trs)
+	if f.mediaType == "text/html" && srv.propLabels != nil {
+		w.Header().Add("Vary", "Cookie")
+		if srv.labelView = requestedView(w, r) == viewLabels; srv.labelView {
+			tag = strings.TrimSuffix(tag, `"`) + "-" + viewLabels + `"`
+		}
+	}
+	w.Header().Set("ETag", tag)
+	modified, known := srv.lastModified(res, trs)
+	if known {
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+	if notModified(r, tag, modified, known) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	var buf bytes.Buffer
+	if err := f.write(srv, &buf, res, trs); err != nil {
+		log.Println(err)
+		srv.serveError(w, f, http.StatusInternalServerError, err.Error(), &res)
+		return
+	}
+	// The buffered response is served with support for HEAD and Range
+	// requests.
+	w.Header().Set("Content-Type", f.contentType())
+	if !known {
+		modified = time.Time{}
+	}
+	http.ServeContent(w, r, "", modified, bytes.NewReader(buf.Bytes()))
+}
+
+// fetchDescription fetches the description of the resource from the
+// backend, in pages if it is capped by the endpoint. Concurrent requests
+// for the same description share a single fetch, so that a burst of
+// requests for a popular resource makes one query. The shared fetch is
+// not canceled with any of the requests, but each gives up on it when it
+// is canceled.
+func (srv server) fetchDescription(res resolution) ([]rdf.Triple, error) {
+	ch := srv.lookups.DoChan(cacheKey(res), func() (interface{}, error) {
+		shared := srv
+		shared.ctx = withQueryTimeout(context.Background(), srv.queryTimeout)
+		trs, err := shared.backend.describe(shared.reqContext(), res, shared.limit())
+		if err == nil && shared.capped(res, trs) {
+			trs, err = shared.fetchPages(res)
+		}
+		return trs, err
+	})
+	select {
+	case r := <-ch:
+		if r.Err != nil {
+			return nil, r.Err
+		}
+		trs := r.Val.([]rdf.Triple)
+		// The triples are sorted and filtered in place.
+		if r.Shared {
+			trs = append([]rdf.Triple(nil), trs...)
+		}
+		return trs, nil
+	case <-srv.reqContext().Done():
+		return nil, srv.reqContext().Err()
+	}
+}
+
+// countWriter counts the bytes written to it, discarding them.
+type countWriter struct {
+	n int64
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	cw.n += int64(len(p))
+	return len(p), nil
+}
+
+// sortTriples sorts trs by subject, then by predicate. Predicates in the
+// configured order come first, the rest alphabetically by prefixed name.
+func (srv server) sortTriples(trs []rdf.Triple) {
 	sort.Slice(trs, func(i, j int) bool {
-		// Sort by subject, then by predicate
 		switch strings.Compare(trs[i].Subject.String(), trs[j].Subject.String()) {
 		case -1:
 			return true
 		case 1:
 			return false
 		}
-		return repl.Replace(trs[i].Predicate.Name()) < repl.Replace(trs[j].Predicate.Name())
+		ri, iok := srv.predicateRank[trs[i].Predicate.Name()]
+		rj, jok := srv.predicateRank[trs[j].Predicate.Name()]
+		switch {
+		case iok && jok:
+			return ri < rj
+		case iok != jok:
+			return iok
+		}
+		return srv.repl.Replace(trs[i].Predicate.Name()) < srv.repl.Replace(trs[j].Predicate.Name())
 	})
+}
 
-	node := rdf.NewNamedNode(srv.base + r.URL.Path)
-	w.Header().Add("Content-Type", "text/html; charset=utf-8")
-	fmt.Fprintf(w, htmlHeader, node)
+// writeHTML renders the description as Turtle in a HTML page, with
+// links to other resources. The page is annotated with RDFa, so that it
+// carries the same triples as the other formats.
+func (srv server) writeHTML(w io.Writer, res resolution, trs []rdf.Triple) error {
+	if srv.htmlMode == htmlMicrodata {
+		if obj := srv.schemaOrg(res, trs); obj != nil {
+			return srv.writeMicrodata(w, res, obj)
+		}
+	}
+	node := rdf.NewNamedNode(res.uri)
+	page := srv.resourcePage(res)
+	page.Title = node.String()
+	page.Head = template.HTML(srv.schemaOrgScript(res, trs))
+	page.Prologue = srv.htmlPrologue(res.route)
+	page.Views = srv.propLabels != nil
+	page.View = viewTurtle
+	if srv.labelView {
+		page.View = viewLabels
+	}
+	page.Languages = srv.languageLinks()
+
+	style := htmlStyle{srv: srv, rt: res.route}
+	crumbs := srv.breadcrumbs(res)
+	style.labels = srv.linkLabels(style, res, trs, crumbs.iris()...)
+	var trail bytes.Buffer
+	writeBreadcrumbs(&trail, style, crumbs, res.uri)
+	page.Breadcrumbs = template.HTML(trail.String())
+	concept := isConcept(node, trs)
+	described := trs
+	if concept {
+		described = withoutSKOSRelations(node, trs)
+	}
+	tables := srv.valueTables(node, described)
+	style.tables = make(map[string]*valueTable)
+	for _, t := range tables {
+		style.tables[t.pred.Name()] = t
+	}
+	anchors := srv.predicateAnchors(node, described)
+	style.anchors = make(map[string]string)
+	for _, a := range anchors {
+		style.anchors[a.pred.Name()] = a.id
+	}
+	var contents bytes.Buffer
+	srv.writeContents(&contents, style, anchors)
+	page.Contents = template.HTML(contents.String())
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "<span about=\"%s\"><strong>%s</strong>\n", html.EscapeString(res.uri), highlight("<"+strings.TrimPrefix(res.uri, res.base+"/")+">"))
+	tw := tabwriter.NewWriter(&body, 0, 0, 4, ' ', tabwriter.FilterHTML)
+	srv.describe(tw, style, described, node, nestedBlankNodes(described))
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	body.WriteString(" .</span>\n")
+	page.Body = template.HTML(body.String())
+	if concept {
+		var nav bytes.Buffer
+		writeSKOS(&nav, style, node, trs)
+		page.Nav = template.HTML(nav.String())
+	}
+	var tablesHTML bytes.Buffer
+	srv.writeTables(&tablesHTML, style, res, tables)
+	page.Tables = template.HTML(tablesHTML.String())
+	var incoming bytes.Buffer
+	writeIncoming(&incoming, style, node, trs)
+	page.Incoming = template.HTML(incoming.String())
+	return srv.writeHTMLPage(w, htmlTurtle, page)
+}
 
-	fmt.Fprintf(w, "<strong>&lt;%s&gt</strong>\n", r.URL.Path[1:])
-	tw := tabwriter.NewWriter(w, 0, 0, 4, ' ', 0)
-	srv.describe(tw, trs, node)
-	tw.Flush()
-	w.Write([]byte(" .\n"))
-	w.Write([]byte(htmlFooter))
+// reqContext returns the context of the request served, or the
+// background context outside of requests.
+func (srv server) reqContext() context.Context {
+	if srv.ctx == nil {
+		return context.Background()
+	}
+	return srv.ctx
+}
+
+// resourcePage returns the page of the resource with the parts shared by
+// the Turtle and microdata views filled in.
+func (srv server) resourcePage(res resolution) htmlPage {
+	page := htmlPage{
+		URI:     res.uri,
+		Formats: srv.formatLinks(res),
+		Viz:     srv.vizURL(res),
+	}
+	if srv.qrCodes {
+		page.QRCode = qrURL(res.uri)
+	}
+	if srv.queryPanel.Enabled {
+		page.SPARQL = res.query
+		page.SPARQLHref = srv.queryLink(res)
+	}
+	if srv.truncated {
+		page.Truncated = srv.tripleLimit
+	}
+	return page
+}
+
+// truncatedHeader is the response header giving the triple limit of a
+// truncated description.
+const truncatedHeader = "Vindu-Truncated"
+
+// limit returns the number of triples read from the endpoints for a
+// description: one more than the triple limit, so that descriptions
+// going over it are told apart, or 0 if it is unlimited.
+func (srv server) limit() int {
+	if srv.tripleLimit == 0 {
+		return 0
+	}
+	return srv.tripleLimit + 1
+}
+
+// truncate cuts trs off at the triple limit, reporting whether it did.
+func (srv server) truncate(trs []rdf.Triple) ([]rdf.Triple, bool) {
+	if srv.tripleLimit == 0 || len(trs) <= srv.tripleLimit {
+		return trs, false
+	}
+	return trs[:srv.tripleLimit], true
+}
+
+// termStyle renders the predicates and objects of a description.
+type termStyle interface {
+	predicate(p rdf.NamedNode) string
+	// object renders a named node or literal, as the object of p.
+	object(p rdf.NamedNode, o rdf.Node) string
+	// list renders a collection of named nodes and literals, as the
+	// object of p.
+	list(p rdf.NamedNode, items []rdf.Node) string
+	// nest returns the strings enclosing the nested description of the
+	// blank node b, as the object of p.
+	nest(p rdf.NamedNode, b rdf.BlankNode) (open, close string)
+}
+
+// htmlStyle renders terms for the HTML view as highlighted Turtle, linking
+// to other resources served by vindu. Objects are annotated with RDFa
+// property attributes.
+type htmlStyle struct {
+	srv server
+	rt  route
+	// labels are the labels of linked resources, keyed by IRI.
+	labels map[string]string
+	// tables are the predicates whose values are also shown as tables.
+	tables map[string]*valueTable
+	// anchors are the ids of the anchors of the predicates of the
+	// described resource.
+	anchors map[string]string
+}
+
+// predicate renders p as a prefixed name, or in the label view as its
+// label from the ontology, if it has one.
+func (s htmlStyle) predicate(p rdf.NamedNode) string {
+	name := turtleStyle{srv: s.srv}.predicate(p)
+	if s.srv.labelView {
+		if label, ok := s.srv.propLabels.get(s.srv.endpoints[0], p.Name()); ok {
+			return fmt.Sprintf(`<span class="plabel" title="%s">%s</span>`, html.EscapeString(name), html.EscapeString(label))
+		}
+	}
+	return highlight(name)
+}
+
+func (s htmlStyle) object(p rdf.NamedNode, o rdf.Node) string {
+	prop := fmt.Sprintf(`property="%s"`, html.EscapeString(p.Name()))
+	if t, ok := s.tables[p.Name()]; ok {
+		return t.wrap(s.annotate(prop, o))
+	}
+	if src, ok := s.imageURL(p, o); ok {
+		return s.image(prop, o, src)
+	}
+	return s.annotate(prop, o)
+}
+
+// list renders the items of a collection, annotated as an RDFa list.
+func (s htmlStyle) list(p rdf.NamedNode, items []rdf.Node) string {
+	prop := fmt.Sprintf(`property="%s" inlist`, html.EscapeString(p.Name()))
+	var objs []string
+	for _, item := range items {
+		objs = append(objs, s.annotate(prop, item))
+	}
+	return "( " + strings.Join(objs, " ") + " )"
 }
 
-func (srv server) describe(w io.Writer, trs []rdf.Triple, node rdf.Node) {
+// annotate renders the named node or literal o, with the RDFa attributes
+// prop relating it to the subject.
+func (s htmlStyle) annotate(prop string, o rdf.Node) string {
+	switch obj := o.(type) {
+	case rdf.NamedNode:
+		iri := html.EscapeString(obj.Name())
+		if rel, ok := s.link(obj.Name()); ok {
+			a := fmt.Sprintf(`<a %s resource="%s" href="%s">%s</a>`, prop, iri, escapeHref(s.rt.prefix+"/"+rel), highlight("<"+rel+">"))
+			if label, ok := s.labels[obj.Name()]; ok {
+				a += ` <span class="label">` + html.EscapeString(label) + `</span>`
+			}
+			return a
+		}
+		if s.srv.previews != nil && s.srv.previews.allowed(obj.Name()) {
+			return fmt.Sprintf(`<span %s resource="%s" class="preview" data-preview="%s">%s</span>`,
+				prop, iri, html.EscapeString(previewPath+"?"+url.Values{"uri": {obj.Name()}}.Encode()), highlight(turtleStyle{srv: s.srv}.iri(obj.Name())))
+		}
+		return fmt.Sprintf(`<span %s resource="%s">%s</span>`, prop, iri, highlight(turtleStyle{srv: s.srv}.iri(obj.Name())))
+	case rdf.Literal:
+		attrs := fmt.Sprintf(`%s content="%s"`, prop, html.EscapeString(obj.ValueAsString()))
+		if obj.Lang() != "" {
+			attrs += fmt.Sprintf(` lang="%s"`, html.EscapeString(obj.Lang()))
+		} else if dt := obj.DataType().Name(); dt != "" && dt != xsdString {
+			attrs += fmt.Sprintf(` datatype="%s"`, html.EscapeString(dt))
+		}
+		if utf8.RuneCountInString(obj.ValueAsString()) > longLiteral {
+			attrs += ` class="fold long"`
+		}
+		return fmt.Sprintf("<span %s>%s</span>", attrs, highlight(turtleStyle{srv: s.srv}.literal(obj)))
+	}
+	return highlight(o.String())
+}
+
+// link returns iri relative to the base URI, if it is a resource to link
+// to.
+func (s htmlStyle) link(iri string) (string, bool) {
+	rel := strings.TrimPrefix(iri, s.rt.base+"/")
+	return rel, rel != iri && s.srv.linkify != nil && s.srv.linkify.MatchString(rel)
+}
+
+// nest links the blank node to its nested description. The opening tags
+// end the line of the predicate, so that they don't affect the alignment.
+// The description, including its line breaks, can be folded away.
+func (s htmlStyle) nest(p rdf.NamedNode, b rdf.BlankNode) (open, close string) {
+	id := html.EscapeString("[" + b.String() + "]")
+	return fmt.Sprintf(`<span property="%s" resource="%s">[<span class="fold" about="%[2]s">`, html.EscapeString(p.Name()), id) + "\n",
+		"\n\t</span>]</span>"
+}
+
+// describe writes the predicates and objects of node in Turtle syntax,
+// with the blank nodes of nested, as returned by nestedBlankNodes, nested
+// where they are referenced, and lists written as collections. Other
+// blank nodes are written by label.
+func (srv server) describe(w io.Writer, style termStyle, trs []rdf.Triple, node rdf.Node, nested map[rdf.Node]bool) {
 	var curPred rdf.NamedNode
 	first := true
 	_, inBlank := node.(rdf.BlankNode)
@@ -134,47 +917,162 @@ func (srv server) describe(w io.Writer, trs []rdf.Triple, node rdf.Node) {
 		}
 		if curPred != tr.Predicate {
 			curPred = tr.Predicate
+			pred := style.predicate(tr.Predicate)
+			if a, ok := style.(anchorStyle); ok && !inBlank {
+				pred = a.anchor(tr.Predicate, pred)
+			}
 			if first {
-				fmt.Fprintf(w, "%s%v\t", indent, repl.Replace(tr.Predicate.Name()))
+				fmt.Fprintf(w, "%s%v\t", indent, pred)
 				first = false
 			} else {
-				fmt.Fprintf(w, " ;\n%s%v\t", indent, repl.Replace(tr.Predicate.Name()))
+				fmt.Fprintf(w, " ;\n%s%v\t", indent, pred)
 			}
 		} else {
 			// object list
 			fmt.Fprintf(w, ",\n\t\t")
 		}
-		switch obj := tr.Object.(type) {
-		case rdf.NamedNode:
-			if rgxpLinkify.MatchString(obj.Name()) {
-				fmt.Fprintf(w, `<a href="/%[1]s">&lt;%[1]s&gt</a>`, strings.TrimPrefix(obj.Name(), srv.base+"/"))
-			} else {
-				fmt.Fprintf(w, `&lt;%s&gt;`, obj.Name())
+		if b, ok := tr.Object.(rdf.BlankNode); ok && nested[b] {
+			if items, ok := rdfList(b, trs); ok {
+				fmt.Fprint(w, style.list(tr.Predicate, items))
+				continue
 			}
-		case rdf.BlankNode:
-			fmt.Fprintf(w, "[\n")
-			srv.describe(w, trs, tr.Object)
-			fmt.Fprintf(w, "\n\t]")
-		case rdf.Literal:
-			fmt.Fprintf(w, "%q", obj.ValueAsString())
+			open, close := style.nest(tr.Predicate, b)
+			fmt.Fprint(w, open)
+			srv.describe(w, style, trs, b, nested)
+			fmt.Fprint(w, close)
+			continue
 		}
+		fmt.Fprint(w, style.object(tr.Predicate, tr.Object))
+	}
+}
+
+// handler serves requests using the current server, which is replaced
+// when the configuration is reloaded.
+type handler struct {
+	srv atomic.Value
+	// maintenance is 1 when in maintenance mode.
+	maintenance int32
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	srv := h.srv.Load().(server)
+	if atomic.LoadInt32(&h.maintenance) == 1 {
+		srv.serveMaintenance(w, r)
+		return
+	}
+	srv.ServeHTTP(w, r)
+}
+
+// setMaintenance turns maintenance mode on or off.
+func (h *handler) setMaintenance(on bool) {
+	var v int32
+	if on {
+		v = 1
+	}
+	atomic.StoreInt32(&h.maintenance, v)
+}
+
+// reload resolves the configuration again, and swaps in a server using
+// it. Listen and TLS settings are only read on startup.
+func (h *handler) reload() error {
+	cfg, err := resolveConfig(os.Args[1:])
+	if err != nil {
+		return err
+	}
+	srv, err := newServer(cfg)
+	if err != nil {
+		return err
 	}
+	h.srv.Store(srv)
+	return nil
 }
 
 func main() {
-	var (
-		graph          = flag.String("graph", "lsext", "Graph to expose")
-		sparqlEndpoint = flag.String("sparq", "http://virtuoso:8890/sparql/", "SPARQL endpoint address")
-	)
-	flag.Parse()
+	cfg, err := resolveConfig(os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	srv := server{
-		graph:  *graph,
-		target: *sparqlEndpoint + "?",
-		base:   "http://data.deichman.no",
+	srv, err := newServer(cfg)
+	if err != nil {
+		log.Fatal(err)
 	}
+	if cfg.Check || cfg.StartupCheck {
+		if err := srv.check(); err != nil {
+			log.Fatalf("checking SPARQL endpoint: %v", err)
+		}
+		if cfg.Check {
+			log.Println("SPARQL endpoint OK")
+			return
+		}
+	}
+
+	h := &handler{}
+	h.srv.Store(srv)
+
+	go func() {
+		// SIGHUP reloads the configuration, SIGUSR1 and SIGUSR2 turns
+		// maintenance mode on and off.
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGHUP, syscall.SIGUSR1, syscall.SIGUSR2)
+		for s := range sig {
+			switch s {
+			case syscall.SIGHUP:
+				if err := h.reload(); err != nil {
+					log.Printf("reloading configuration: %v", err)
+					continue
+				}
+				log.Println("configuration reloaded")
+			case syscall.SIGUSR1:
+				h.setMaintenance(true)
+				log.Println("maintenance mode on")
+			case syscall.SIGUSR2:
+				h.setMaintenance(false)
+				log.Println("maintenance mode off")
+			}
+		}
+	}()
 
-	if err := http.ListenAndServe(":7777", srv); err != nil {
+	public, admin, err := listen(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	tlsCfg, err := tlsConfig(cfg)
+	if err != nil {
 		log.Fatal(err)
 	}
+	hs := &http.Server{Handler: compress(h)}
+	as := &http.Server{Handler: h.admin()}
+
+	errc := make(chan error, len(public)+len(admin))
+	for _, l := range public {
+		if tlsCfg != nil {
+			l = tls.NewListener(l, tlsCfg)
+		}
+		go func(l net.Listener) { errc <- hs.Serve(l) }(l)
+	}
+	for _, l := range admin {
+		go func(l net.Listener) { errc <- as.Serve(l) }(l)
+	}
+
+	go func() {
+		// Stop accepting connections on SIGINT/SIGTERM, and give
+		// in-flight requests some time to complete.
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+		log.Printf("received %v, shutting down", <-sig)
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+		defer cancel()
+		for _, s := range []*http.Server{hs, as} {
+			if err := s.Shutdown(ctx); err != nil {
+				log.Println(err)
+			}
+		}
+	}()
+
+	for range append(public, admin...) {
+		if err := <-errc; err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}
 }
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// vizPath is where the neighborhood diagrams of resources are served,
+// under the path of the resource.
+const vizPath = "/viz"
+
+const vizQuery = `SELECT ?s ?p ?o WHERE { { <%s> ?p ?o BIND (<%[1]s> AS ?s) FILTER (isIRI(?o) && ?p != <http://www.w3.org/1999/02/22-rdf-syntax-ns#type>) } UNION { ?s ?p <%[1]s> BIND (<%[1]s> AS ?o) FILTER (isIRI(?s) && ?s != <%[1]s>) } } LIMIT %d`
+
+// vizNode is a resource of a neighborhood diagram. Href is the diagram of
+// the resource, if it is served by vindu, and Group the first segment of
+// its path, e.g. "work" or "person".
+type vizNode struct {
+	ID    string `json:"id"`
+	Label string `json:"label"`
+	Href  string `json:"href,omitempty"`
+	Group string `json:"group,omitempty"`
+}
+
+// vizLink is a link between two resources of a neighborhood diagram,
+// labeled by its predicate.
+type vizLink struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Label  string `json:"label"`
+}
+
+// vizGraph is the neighborhood of a resource. The resource itself is the
+// first node.
+type vizGraph struct {
+	Nodes []vizNode `json:"nodes"`
+	Links []vizLink `json:"links"`
+}
+
+// neighborhood returns the resources linked to and from the resource, up
+// to the configured limit of links. Types are left out.
+func (srv server) neighborhood(res resolution) (vizGraph, error) {
+	rows, err := selectRows(srv.reqContext(), srv.endpoints[0], res.graph, fmt.Sprintf(vizQuery, res.uri, srv.vizLimit))
+	if err != nil {
+		return vizGraph{}, err
+	}
+	s := htmlStyle{srv: srv, rt: res.route}
+	g := vizGraph{Nodes: []vizNode{}, Links: []vizLink{}}
+	index := make(map[string]int)
+	var iris []string
+	add := func(iri string) {
+		if _, ok := index[iri]; ok {
+			return
+		}
+		n := vizNode{ID: iri, Label: srv.compactIRI(iri)}
+		if rel, ok := s.link(iri); ok {
+			n.Href = (&url.URL{Path: vizPath + res.prefix + "/" + rel}).EscapedPath()
+			n.Group = strings.SplitN(rel, "/", 2)[0]
+		}
+		index[iri] = len(g.Nodes)
+		g.Nodes = append(g.Nodes, n)
+		iris = append(iris, iri)
+	}
+	add(res.uri)
+	for _, row := range rows {
+		add(row["s"])
+		add(row["o"])
+		g.Links = append(g.Links, vizLink{Source: row["s"], Target: row["o"], Label: srv.compactIRI(row["p"])})
+	}
+	for iri, label := range srv.lookupLabels(res.graph, iris) {
+		g.Nodes[index[iri]].Label = label
+	}
+	return g, nil
+}
+
+// serveViz serves the neighborhood diagram of the resource at the path
+// following /viz. The page draws the diagram with the viz script, from
+// the neighborhood served as JSON with format=json.
+func (srv server) serveViz(w http.ResponseWriter, r *http.Request) {
+	f, _ := formatByName("html")
+	path := strings.TrimPrefix(r.URL.Path, vizPath)
+	res, err := srv.resolver.resolve(path)
+	if err != nil {
+		srv.serveError(w, f, resolveStatus(err), err.Error(), nil)
+		return
+	}
+	if r.FormValue("format") == "json" {
+		g, err := srv.neighborhood(res)
+		if err != nil {
+			http.Error(w, err.Error(), upstreamStatus(w, err, http.StatusInternalServerError))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(g)
+		return
+	}
+	data := (&url.URL{Path: r.URL.Path, RawQuery: url.Values{"format": {"json"}}.Encode()}).String()
+	body := fmt.Sprintf("<p><a href=\"%s\">%s</a></p>\n", escapeHref((&url.URL{Path: path}).EscapedPath()), html.EscapeString(res.uri))
+	w.Header().Set("Content-Type", f.contentType())
+	err = srv.writeHTMLPage(w, "viz", htmlPage{
+		Title: "Graph: " + srv.compactIRI(res.uri),
+		Body:  template.HTML(body),
+		Graph: data,
+	})
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// vizURL returns the URL of the neighborhood diagram of the resource, or
+// the empty string if diagrams are disabled or the resource is not
+// relative to the base URI.
+func (srv server) vizURL(res resolution) string {
+	rel := strings.TrimPrefix(res.uri, res.base+"/")
+	if srv.vizLimit == 0 || rel == res.uri {
+		return ""
+	}
+	return (&url.URL{Path: vizPath + res.prefix + "/" + rel}).EscapedPath()
+}